@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/lockout"
+)
+
+// audit writes a security relevant event to the audit_events table. Failing
+// to audit never fails the request, it is only logged.
+func (cfg *apiConfig) audit(ctx context.Context, eventType string, actorID uuid.NullUUID, target, details string) {
+	err := cfg.dbQueries.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		EventType: eventType,
+		ActorID:   actorID,
+		Target:    target,
+		Details:   details,
+	})
+	if err != nil {
+		log.Printf("Couldn't write audit event %s for %s: %v", eventType, target, err)
+	}
+}
+
+// auditLockoutEvent is the lockout.Guard event hook. The guard calls it while
+// holding its lock, so the write happens in the background.
+func (cfg *apiConfig) auditLockoutEvent(e lockout.Event) {
+	details := fmt.Sprintf("%s=%s failures=%d", e.Kind, e.Key, e.Failures)
+	go cfg.audit(context.Background(), e.Type, uuid.NullUUID{}, e.Key, details)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+)
+
+type authMode int
+
+const (
+	// authRequired answers 401 when no credentials are sent.
+	authRequired authMode = iota
+	// authOptional lets anonymous requests through without a principal.
+	// Credentials that are sent must still be valid.
+	authOptional
+)
+
+var errNoCredentials = errors.New("No credentials")
+
+// MiddlewareAuthenticate resolves the Authorization header to a principal
+// and stores it in the request context. A non-empty scope must be held by
+// the principal.
+func (cfg *apiConfig) MiddlewareAuthenticate(mode authMode, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.authenticate(r)
+		if errors.Is(err, errNoCredentials) && mode == authOptional {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			respondWithError(w, 401, "Not authenticated", err)
+			return
+		}
+		if scope != "" && !principal.HasScope(scope) {
+			respondWithError(w, 403, "Token lacks "+scope+" scope", nil)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func (cfg *apiConfig) requireAuth(scope string, handler http.HandlerFunc) http.Handler {
+	return cfg.MiddlewareAuthenticate(authRequired, scope, handler)
+}
+
+func (cfg *apiConfig) optionalAuth(handler http.HandlerFunc) http.Handler {
+	return cfg.MiddlewareAuthenticate(authOptional, "", handler)
+}
+
+// authenticate accepts a JWT access token or personal access token as a
+// Bearer credential, or the service API key as an ApiKey credential.
+func (cfg *apiConfig) authenticate(r *http.Request) (auth.Principal, error) {
+	if r.Header.Get("Authorization") == "" {
+		return auth.Principal{}, errNoCredentials
+	}
+
+	if key, err := auth.GetAPIKey(r.Header); err == nil {
+		if cfg.ApiKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.ApiKey)) != 1 {
+			return auth.Principal{}, errors.New("Wrong api key")
+		}
+		return auth.Principal{Method: auth.AuthMethodAPIKey, Scopes: []string{auth.ScopeWebhooks}}, nil
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	return cfg.authenticateBearer(r.Context(), token)
+}
+
+// authenticateBearer resolves a JWT access token or personal access token.
+func (cfg *apiConfig) authenticateBearer(ctx context.Context, token string) (auth.Principal, error) {
+	if auth.IsPersonalAccessToken(token) {
+		return cfg.authenticatePersonalAccessToken(ctx, token)
+	}
+
+	claims, err := cfg.JwtKeys.ParseJWT(token, auth.DefaultAudience)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	principal := auth.Principal{
+		UserID:    claims.UserID,
+		Method:    auth.AuthMethodJWT,
+		Scopes:    claims.Scopes,
+		TokenID:   claims.TokenID,
+		ExpiresAt: claims.ExpiresAt,
+	}
+	if claims.ClientID != "" {
+		return cfg.authenticateOAuthClient(ctx, principal, claims.ClientID)
+	}
+	return principal, nil
+}
+
+// authenticateOAuthClient checks that the client an access token was issued
+// to hasn't been revoked since, so revocation takes effect immediately.
+func (cfg *apiConfig) authenticateOAuthClient(ctx context.Context, principal auth.Principal, clientID string) (auth.Principal, error) {
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	client, err := cfg.dbQueries.GetOAuthClientByID(ctx, id)
+	if err != nil {
+		return auth.Principal{}, errors.New("Unknown OAuth client")
+	}
+	if client.RevokedAt.Valid {
+		return auth.Principal{}, errors.New("OAuth client revoked")
+	}
+	principal.Method = auth.AuthMethodOAuth
+	principal.ClientID = client.ID
+	return principal, nil
+}
+
+func (cfg *apiConfig) authenticatePersonalAccessToken(ctx context.Context, token string) (auth.Principal, error) {
+	pat, err := cfg.dbQueries.GetPersonalAccessTokenByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		return auth.Principal{}, errors.New("Unknown personal access token")
+	}
+	if pat.RevokedAt.Valid {
+		return auth.Principal{}, errors.New("Personal access token revoked")
+	}
+	if pat.ExpiresAt.Valid && time.Now().After(pat.ExpiresAt.Time) {
+		return auth.Principal{}, errors.New("Personal access token expired")
+	}
+	if err := cfg.dbQueries.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		return auth.Principal{}, err
+	}
+
+	return auth.Principal{
+		UserID:    pat.UserID,
+		Method:    auth.AuthMethodPersonalAccessToken,
+		Scopes:    pat.Scopes,
+		TokenID:   pat.ID.String(),
+		ExpiresAt: pat.ExpiresAt.Time,
+	}, nil
+}
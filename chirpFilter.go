@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hconn7/Chirpy/internal/filter"
+)
+
+// defaultFilterRules apply until the rules have been loaded from the
+// filter_rules table.
+var defaultFilterRules = []filter.Rule{
+	{Phrase: "kerfuffle", Action: filter.ActionMask},
+	{Phrase: "sharbert", Action: filter.ActionMask},
+	{Phrase: "fornax", Action: filter.ActionMask},
+}
+
+var defaultChirpFilter = filter.Compile(defaultFilterRules)
+
+// chirpFilter returns the current compiled filter.
+func (cfg *apiConfig) chirpFilter() *filter.Matcher {
+	if m := cfg.compiledFilter.Load(); m != nil {
+		return m
+	}
+	return defaultChirpFilter
+}
+
+// reloadChirpFilter compiles the rules in the database and swaps them in.
+// Requests already checking a chirp finish with the old rules.
+func (cfg *apiConfig) reloadChirpFilter(ctx context.Context) error {
+	rows, err := cfg.dbQueries.GetFilterRules(ctx)
+	if err != nil {
+		return err
+	}
+	rules := make([]filter.Rule, 0, len(rows))
+	for _, row := range rows {
+		rules = append(rules, filter.Rule{Phrase: row.Phrase, Action: filter.Action(row.Action)})
+	}
+	cfg.compiledFilter.Store(filter.Compile(rules))
+	return nil
+}
+
+// runChirpFilterReloader keeps the filter in sync with rules changed
+// through another instance.
+func (cfg *apiConfig) runChirpFilterReloader(interval time.Duration) {
+	for {
+		if err := cfg.reloadChirpFilter(context.Background()); err != nil {
+			log.Printf("Couldn't reload chirp filter: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/filter"
+	"github.com/hconn7/Chirpy/internal/pubsub"
+	"github.com/lib/pq"
+)
+
+const (
+	chirpEventCreated = "chirp.created"
+	chirpEventDeleted = "chirp.deleted"
+
+	// chirpEventsChannel is the Postgres NOTIFY channel new events are
+	// announced on.
+	chirpEventsChannel = "chirp_events"
+	// chirpEventRetention is how far back a client can resume from.
+	chirpEventRetention = 24 * time.Hour
+	chirpEventBatch     = 100
+	// chirpEventLateCommit is how long an event ID skipped over is waited
+	// for. IDs are taken on insert, so a concurrent insert can commit a
+	// higher ID first.
+	chirpEventLateCommit = time.Minute
+
+	streamHeartbeat = 15 * time.Second
+	streamRetry     = 5 * time.Second
+)
+
+// publishChirpEvent records a chirp being posted or removed and wakes every
+// instance's event stream. A removed chirp's body is dropped from the log.
+// Like audit, failing to publish doesn't fail the request.
+func (cfg *apiConfig) publishChirpEvent(ctx context.Context, eventType string, chirp database.Chirp) {
+	body := chirp.Body
+	if eventType == chirpEventDeleted {
+		if err := cfg.dbQueries.DeleteChirpCreatedEvents(ctx, chirp.ID); err != nil {
+			log.Printf("Couldn't remove events for chirp %s: %v", chirp.ID, err)
+		}
+		body = ""
+	}
+	event, err := cfg.dbQueries.CreateChirpEvent(ctx, database.CreateChirpEventParams{
+		Type:           eventType,
+		ChirpID:        chirp.ID,
+		UserID:         chirp.UserID,
+		Body:           body,
+		ChirpCreatedAt: chirp.CreatedAt,
+	})
+	if err != nil {
+		log.Printf("Couldn't record %s event for chirp %s: %v", eventType, chirp.ID, err)
+		return
+	}
+	if err := cfg.dbQueries.NotifyChirpEvent(ctx, strconv.FormatInt(event.ID, 10)); err != nil {
+		log.Printf("Couldn't announce chirp event %d: %v", event.ID, err)
+	}
+}
+
+// relayChirpEvents hands every event the cursor hasn't seen, including ones
+// that committed late, to this instance's subscribers.
+func (cfg *apiConfig) relayChirpEvents(ctx context.Context, cursor *pubsub.Cursor) {
+	cursor.Expire(time.Now(), chirpEventLateCommit)
+	from := cursor.From()
+	for {
+		events, err := cfg.dbQueries.GetChirpEventsAfter(ctx, database.GetChirpEventsAfterParams{
+			ID:    from,
+			Limit: chirpEventBatch,
+		})
+		if err != nil {
+			log.Printf("Couldn't retrieve chirp events: %v", err)
+			return
+		}
+		for _, event := range events {
+			from = event.ID
+			if cursor.Accept(event.ID, time.Now()) {
+				cfg.chirpEvents.Publish(event)
+			}
+		}
+		if len(events) < chirpEventBatch {
+			return
+		}
+	}
+}
+
+// runChirpEventListener waits for NOTIFY on chirpEventsChannel and relays
+// the new events. Notifications only say that something happened; the
+// events themselves are read from chirp_events, so none are lost while the
+// connection is re-established. The same connection relays new in-app
+// notifications announced on notificationsChannel.
+func (cfg *apiConfig) runChirpEventListener(dbURL string) {
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Chirp event listener: %v", err)
+		}
+	})
+	for _, channel := range []string{chirpEventsChannel, notificationsChannel} {
+		if err := listener.Listen(channel); err != nil {
+			log.Printf("Couldn't listen on %s: %v", channel, err)
+			return
+		}
+	}
+
+	ctx := context.Background()
+	lastID, err := cfg.dbQueries.GetLatestChirpEventID(ctx)
+	if err != nil {
+		log.Printf("Couldn't retrieve latest chirp event: %v", err)
+	}
+	cursor := pubsub.NewCursor(lastID)
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	for {
+		select {
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established.
+			if n != nil && n.Channel == notificationsChannel {
+				cfg.relayNotification(ctx, n.Extra)
+				continue
+			}
+		case <-time.After(time.Minute):
+			// Catches anything missed if the connection dropped silently.
+			go listener.Ping()
+		case <-prune.C:
+			if _, err := cfg.dbQueries.DeleteChirpEventsBefore(ctx, time.Now().Add(-chirpEventRetention)); err != nil {
+				log.Printf("Couldn't prune chirp events: %v", err)
+			}
+		}
+		cfg.relayChirpEvents(ctx, cursor)
+	}
+}
+
+// ChirpDeleted is the data of a chirp.deleted event. It is also sent when a
+// moderator hides a chirp.
+type ChirpDeleted struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// chirpEventData is what a stream client receives for an event.
+func chirpEventData(event database.ChirpEvent) any {
+	if event.Type == chirpEventDeleted {
+		return ChirpDeleted{ID: event.ChirpID, UserID: event.UserID}
+	}
+	return Chirp{
+		ID:        event.ChirpID,
+		CreatedAt: event.ChirpCreatedAt,
+		UpdatedAt: event.ChirpCreatedAt,
+		Body:      event.Body,
+		UserID:    event.UserID,
+	}
+}
+
+// chirpStreamFilter picks the events a stream client asked for.
+type chirpStreamFilter struct {
+	viewerID uuid.UUID
+	authorID uuid.UUID
+	hashtag  string
+	blocked  map[uuid.UUID]bool
+	// muted and mutedWords are only applied to timelines. The viewer's own
+	// chirps are never muted.
+	muted      map[uuid.UUID]bool
+	mutedWords mutedWords
+}
+
+func (f chirpStreamFilter) matches(event database.ChirpEvent) bool {
+	if f.blocked[event.UserID] {
+		return false
+	}
+	if f.authorID != uuid.Nil && event.UserID != f.authorID {
+		return false
+	}
+	// Deleted events carry no body to match on. Clients ignore deletions
+	// of chirps they never received.
+	if event.Type == chirpEventDeleted {
+		return true
+	}
+	if event.UserID != f.viewerID && (f.muted[event.UserID] || f.mutedWords.mutes(event.Body)) {
+		return false
+	}
+	if f.hashtag != "" {
+		for _, tag := range filter.Hashtags(event.Body) {
+			if tag == f.hashtag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// blockedUserIDs returns everyone the viewer blocked or was blocked by.
+func (cfg *apiConfig) blockedUserIDs(ctx context.Context, viewerID uuid.UUID) (map[uuid.UUID]bool, error) {
+	blocked := map[uuid.UUID]bool{}
+	if viewerID == uuid.Nil {
+		return blocked, nil
+	}
+	ids, err := cfg.dbQueries.GetBlockedUserIDs(ctx, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		blocked[id] = true
+	}
+	return blocked, nil
+}
+
+// timelineFilter picks the chirp events for the viewer's timeline: anything
+// not blocked or muted.
+func (cfg *apiConfig) timelineFilter(ctx context.Context, viewerID uuid.UUID) (chirpStreamFilter, error) {
+	blocked, err := cfg.blockedUserIDs(ctx, viewerID)
+	if err != nil {
+		return chirpStreamFilter{}, err
+	}
+	mutes, err := cfg.dbQueries.GetUserMutes(ctx, viewerID)
+	if err != nil {
+		return chirpStreamFilter{}, err
+	}
+	muted := map[uuid.UUID]bool{}
+	for _, mute := range mutes {
+		muted[mute.MutedID] = true
+	}
+	words, err := cfg.mutedWordsFor(ctx, viewerID)
+	if err != nil {
+		return chirpStreamFilter{}, err
+	}
+	return chirpStreamFilter{viewerID: viewerID, blocked: blocked, muted: muted, mutedWords: words}, nil
+}
+
+// writeChirpEvent writes an event with the stream's cursor as its ID, so a
+// client resuming with Last-Event-ID also gets events that committed late.
+func writeChirpEvent(w http.ResponseWriter, event database.ChirpEvent, cursor *pubsub.Cursor) error {
+	data, err := json.Marshal(chirpEventData(event))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", cursor, event.Type, data)
+	return err
+}
+
+// handlerChirpStream streams chirp.created and chirp.deleted events as
+// Server-Sent Events, optionally only those of one author (?author_id=) or
+// hashtag (?hashtag=). Event IDs are opaque cursors; a client reconnecting
+// with Last-Event-ID first gets the events it missed, as far back as
+// chirpEventRetention, leaving out chirps it can no longer see.
+func (cfg *apiConfig) handlerChirpStream(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var streamFilter chirpStreamFilter
+	if s := query.Get("author_id"); s != "" {
+		authorID, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, 400, "Invalid author_id", err)
+			return
+		}
+		streamFilter.authorID = authorID
+	}
+	if s := query.Get("hashtag"); s != "" {
+		if streamFilter.hashtag = filter.NormalizeHashtag(s); streamFilter.hashtag == "" {
+			respondWithError(w, 400, "Invalid hashtag", nil)
+			return
+		}
+	}
+	cursor := &pubsub.Cursor{}
+	resumed := false
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		var err error
+		if cursor, err = pubsub.ParseCursor(s, time.Now()); err != nil {
+			respondWithError(w, 400, "Invalid Last-Event-ID", err)
+			return
+		}
+		resumed = true
+	}
+
+	viewer, _ := auth.PrincipalFromContext(r.Context())
+	streamFilter.viewerID = viewer.UserID
+	blocked, err := cfg.blockedUserIDs(r.Context(), viewer.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve blocks", err)
+		return
+	}
+	streamFilter.blocked = blocked
+
+	// Subscribe before catching up so nothing falls in between.
+	events, unsubscribe := cfg.chirpEvents.Subscribe()
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if err := rc.Flush(); err != nil {
+		log.Printf("Chirp stream can't flush: %v", err)
+		return
+	}
+
+	if resumed {
+		from := cursor.From()
+		for {
+			missed, err := cfg.dbQueries.GetVisibleChirpEventsAfter(r.Context(), database.GetVisibleChirpEventsAfterParams{
+				ViewerID:   viewer.UserID,
+				ID:         from,
+				MaxResults: chirpEventBatch,
+			})
+			if err != nil {
+				log.Printf("Couldn't retrieve missed chirp events: %v", err)
+				return
+			}
+			for _, row := range missed {
+				from = row.ID
+				event := database.ChirpEvent{
+					ID:             row.ID,
+					CreatedAt:      row.CreatedAt,
+					Type:           row.Type,
+					ChirpID:        row.ChirpID,
+					UserID:         row.UserID,
+					Body:           row.Body,
+					ChirpCreatedAt: row.ChirpCreatedAt,
+				}
+				if cursor.Accept(event.ID, time.Now()) && row.Visible && streamFilter.matches(event) {
+					if err := writeChirpEvent(w, event, cursor); err != nil {
+						return
+					}
+				}
+			}
+			if len(missed) < chirpEventBatch {
+				break
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// Fell too far behind; the client reconnects with
+				// Last-Event-ID and catches up from the database.
+				return
+			}
+			// The broker relays each event once, so only events the
+			// catch-up already sent can repeat.
+			if !cursor.Accept(event.ID, time.Now()) && resumed {
+				continue
+			}
+			if !streamFilter.matches(event) {
+				continue
+			}
+			if err := writeChirpEvent(w, event, cursor); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			cursor.Expire(time.Now(), chirpEventLateCommit)
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/archive"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+// handlerDeleteAccount schedules the caller's account for deletion after
+// the grace period and signs it out everywhere. Logging in again before the
+// grace period ends cancels the deletion.
+func (cfg *apiConfig) handlerDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	type Response struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	if user.DeletionScheduledAt.Valid {
+		respondWithError(w, 409, "Account deletion is already scheduled", nil)
+		return
+	}
+
+	if !cfg.reauthenticate(w, r, user, params.Password, params.Code) {
+		return
+	}
+
+	deleteAt := time.Now().Add(cfg.DeletionGracePeriod)
+	if err := cfg.dbQueries.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+		ID:                  user.ID,
+		DeletionScheduledAt: sql.NullTime{Time: deleteAt, Valid: true},
+	}); err != nil {
+		respondWithError(w, 500, "Couldn't schedule deletion", err)
+		return
+	}
+	if err := cfg.dbQueries.RevokeAllRefreshTokensForUser(r.Context(), user.ID); err != nil {
+		respondWithError(w, 500, "Couldn't revoke sessions", err)
+		return
+	}
+	if err := cfg.dbQueries.RevokeAllPersonalAccessTokensForUser(r.Context(), user.ID); err != nil {
+		respondWithError(w, 500, "Couldn't revoke tokens", err)
+		return
+	}
+	if err := cfg.dbQueries.RevokeOAuthRefreshTokensForUser(r.Context(), user.ID); err != nil {
+		respondWithError(w, 500, "Couldn't revoke app access", err)
+		return
+	}
+	cfg.audit(r.Context(), "account.deletion_scheduled", uuid.NullUUID{UUID: user.ID, Valid: true}, user.ID.String(), deleteAt.Format(time.RFC3339))
+
+	respondWithJson(w, 202, Response{DeletionScheduledAt: deleteAt})
+}
+
+// cancelAccountDeletion keeps the account of a user who logs in during the
+// grace period.
+func (cfg *apiConfig) cancelAccountDeletion(ctx context.Context, user database.User) {
+	if !user.DeletionScheduledAt.Valid {
+		return
+	}
+	if err := cfg.dbQueries.CancelUserDeletion(ctx, user.ID); err != nil {
+		log.Printf("Couldn't cancel deletion of %s: %v", user.ID, err)
+		return
+	}
+	cfg.audit(ctx, "account.deletion_cancelled", uuid.NullUUID{UUID: user.ID, Valid: true}, user.ID.String(), "")
+}
+
+// purgeDeletedAccounts deletes every account whose grace period has ended.
+// Chirps, chirp events, sessions, tokens and everything else owned by the
+// user go with it through ON DELETE CASCADE.
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context) {
+	deleted, err := cfg.dbQueries.DeleteUsersScheduledBefore(ctx, sql.NullTime{Time: time.Now(), Valid: true})
+	if err != nil {
+		log.Printf("Couldn't purge deleted accounts: %v", err)
+		return
+	}
+	for _, id := range deleted {
+		cfg.audit(ctx, "account.deleted", uuid.NullUUID{}, id.String(), "")
+	}
+}
+
+func (cfg *apiConfig) runAccountPurger(interval time.Duration) {
+	for {
+		cfg.purgeDeletedAccounts(context.Background())
+		time.Sleep(interval)
+	}
+}
+
+// handlerExportAccount sends a ZIP of everything Chirpy stores about the
+// caller, for data portability requests.
+func (cfg *apiConfig) handlerExportAccount(w http.ResponseWriter, r *http.Request) {
+	type Profile struct {
+		ID                  uuid.UUID  `json:"id"`
+		Email               string     `json:"email"`
+		DisplayName         *string    `json:"display_name"`
+		Bio                 *string    `json:"bio"`
+		CreatedAt           time.Time  `json:"created_at"`
+		UpdatedAt           time.Time  `json:"updated_at"`
+		EmailVerified       bool       `json:"email_verified"`
+		IsChirpyRed         bool       `json:"is_chirpy_red"`
+		Role                string     `json:"role"`
+		TotpEnabled         bool       `json:"totp_enabled"`
+		DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+	}
+	type Identity struct {
+		Issuer      string     `json:"issuer"`
+		Subject     string     `json:"subject"`
+		Email       string     `json:"email"`
+		LinkedAt    time.Time  `json:"linked_at"`
+		LastLoginAt *time.Time `json:"last_login_at"`
+	}
+	type ExportSession struct {
+		Session
+		RevokedAt *time.Time `json:"revoked_at"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	ctx := r.Context()
+
+	user, err := cfg.dbQueries.GetUserByID(ctx, principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	profile := Profile{
+		ID:            user.ID,
+		Email:         user.Email,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
+		TotpEnabled:   user.TotpEnabled,
+	}
+	if user.DisplayName.Valid {
+		profile.DisplayName = &user.DisplayName.String
+	}
+	if user.Bio.Valid {
+		profile.Bio = &user.Bio.String
+	}
+	if user.DeletionScheduledAt.Valid {
+		profile.DeletionScheduledAt = &user.DeletionScheduledAt.Time
+	}
+
+	dbChirps, err := cfg.dbQueries.GetChirpByUserID(ctx, user.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve chirps", err)
+		return
+	}
+	chirps := []Chirp{}
+	for _, c := range dbChirps {
+		chirps = append(chirps, Chirp{ID: c.ID, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, UserID: c.UserID, Body: c.Body})
+	}
+
+	tokens, err := cfg.dbQueries.GetRefreshTokensByUserID(ctx, user.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve sessions", err)
+		return
+	}
+	sessions := []ExportSession{}
+	for _, tok := range tokens {
+		session := ExportSession{Session: Session{
+			ID:        tok.ID,
+			CreatedAt: tok.CreatedAt,
+			ExpiresAt: tok.ExpiresAt,
+			UserAgent: tok.UserAgent,
+			IpAddress: tok.IpAddress,
+		}}
+		if tok.LastUsedAt.Valid {
+			session.LastUsedAt = &tok.LastUsedAt.Time
+		}
+		if tok.RevokedAt.Valid {
+			session.RevokedAt = &tok.RevokedAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+
+	pats, err := cfg.dbQueries.GetPersonalAccessTokensByUserID(ctx, user.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve tokens", err)
+		return
+	}
+	personalAccessTokens := []PersonalAccessToken{}
+	for _, pat := range pats {
+		personalAccessTokens = append(personalAccessTokens, toPersonalAccessToken(pat))
+	}
+
+	links, err := cfg.dbQueries.GetUserIdentitiesByUserID(ctx, user.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve linked identities", err)
+		return
+	}
+	identities := []Identity{}
+	for _, link := range links {
+		identity := Identity{Issuer: link.Issuer, Subject: link.Subject, Email: link.Email, LinkedAt: link.CreatedAt}
+		if link.LastLoginAt.Valid {
+			identity.LastLoginAt = &link.LastLoginAt.Time
+		}
+		identities = append(identities, identity)
+	}
+
+	clients, err := cfg.dbQueries.GetOAuthClientsByOwnerID(ctx, user.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve OAuth clients", err)
+		return
+	}
+	oauthClients := []OAuthClient{}
+	for _, client := range clients {
+		oauthClients = append(oauthClients, toOAuthClient(client))
+	}
+
+	exportedAt := time.Now().UTC()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, exportedAt.Format("20060102")))
+	w.Header().Set("Cache-Control", "no-store")
+	if err := archive.WriteZip(w, []archive.File{
+		{Name: "profile.json", Data: profile},
+		{Name: "chirps.json", Data: chirps},
+		{Name: "sessions.json", Data: sessions},
+		{Name: "personal_access_tokens.json", Data: personalAccessTokens},
+		{Name: "linked_identities.json", Data: identities},
+		{Name: "oauth_clients.json", Data: oauthClients},
+	}, exportedAt); err != nil {
+		// Headers are already sent, so all that's left is to log it.
+		log.Printf("Couldn't write export for %s: %v", user.ID, err)
+	}
+}
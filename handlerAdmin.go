@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+// bootstrapAdmin promotes the account named by ADMIN_BOOTSTRAP_EMAIL to admin
+// as long as there is no admin yet. The address must be verified, otherwise
+// anyone could register it first and claim the role.
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context) {
+	if cfg.AdminBootstrapEmail == "" {
+		return
+	}
+	admins, err := cfg.dbQueries.CountUsersWithRole(ctx, string(auth.RoleAdmin))
+	if err != nil || admins > 0 {
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByEmail(ctx, cfg.AdminBootstrapEmail)
+	if err != nil || !user.EmailVerifiedAt.Valid {
+		return
+	}
+	if err := cfg.dbQueries.UpdateUserRole(ctx, database.UpdateUserRoleParams{
+		ID:   user.ID,
+		Role: string(auth.RoleAdmin),
+	}); err != nil {
+		log.Printf("Couldn't bootstrap admin %s: %v", user.Email, err)
+		return
+	}
+	cfg.audit(ctx, "role.bootstrapped", uuid.NullUUID{}, user.ID.String(), string(auth.RoleAdmin))
+	log.Printf("Promoted %s to admin", user.Email)
+}
+
+func (cfg *apiConfig) handlerSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Role string `json:"role"`
+	}
+	type Response struct {
+		ID        uuid.UUID `json:"id"`
+		Email     string    `json:"email"`
+		Role      string    `json:"role"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid user ID", err)
+		return
+	}
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	if !auth.ValidRole(params.Role) {
+		respondWithError(w, 400, "Role must be user, moderator or admin", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	if user.Role == string(auth.RoleAdmin) && params.Role != string(auth.RoleAdmin) {
+		admins, err := cfg.dbQueries.CountUsersWithRole(r.Context(), string(auth.RoleAdmin))
+		if err != nil {
+			respondWithError(w, 500, "Couldn't count admins", err)
+			return
+		}
+		if admins <= 1 {
+			respondWithError(w, 409, "Can't demote the last admin", nil)
+			return
+		}
+	}
+
+	if err := cfg.dbQueries.UpdateUserRole(r.Context(), database.UpdateUserRoleParams{
+		ID:   user.ID,
+		Role: params.Role,
+	}); err != nil {
+		respondWithError(w, 500, "Couldn't update role", err)
+		return
+	}
+	actor, _ := actorFromContext(r.Context())
+	cfg.audit(r.Context(), "role.changed", uuid.NullUUID{UUID: actor.ID, Valid: true}, user.ID.String(), user.Role+" -> "+params.Role)
+
+	respondWithJson(w, 200, Response{
+		ID:        user.ID,
+		Email:     user.Email,
+		Role:      params.Role,
+		UpdatedAt: time.Now(),
+	})
+}
+
+func (cfg *apiConfig) handlerGetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	type AuditEvent struct {
+		ID        uuid.UUID  `json:"id"`
+		CreatedAt time.Time  `json:"created_at"`
+		EventType string     `json:"event_type"`
+		ActorID   *uuid.UUID `json:"actor_id"`
+		Target    string     `json:"target"`
+		Details   string     `json:"details"`
+	}
+
+	limit := 100
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 1000 {
+		limit = n
+	}
+	events, err := cfg.dbQueries.GetAuditEvents(r.Context(), int32(limit))
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve audit events", err)
+		return
+	}
+
+	resp := []AuditEvent{}
+	for _, e := range events {
+		event := AuditEvent{
+			ID:        e.ID,
+			CreatedAt: e.CreatedAt,
+			EventType: e.EventType,
+			Target:    e.Target,
+			Details:   e.Details,
+		}
+		if e.ActorID.Valid {
+			event.ActorID = &e.ActorID.UUID
+		}
+		resp = append(resp, event)
+	}
+	respondWithJson(w, 200, resp)
+}
+
+// handlerModerateDeleteChirp lets moderators remove any chirp, not just
+// their own.
+func (cfg *apiConfig) handlerModerateDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid chirp ID", err)
+		return
+	}
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, 404, "No chirp found", err)
+		return
+	}
+	if err := cfg.dbQueries.DeleteChirp(r.Context(), chirp.ID); err != nil {
+		respondWithError(w, 500, "issue deleting chirp", err)
+		return
+	}
+	cfg.publishChirpEvent(r.Context(), chirpEventDeleted, chirp)
+
+	actor, _ := actorFromContext(r.Context())
+	cfg.audit(r.Context(), "chirp.removed", uuid.NullUUID{UUID: actor.ID, Valid: true}, chirp.ID.String(), "author="+chirp.UserID.String())
+	cfg.recordModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: actor.ID, Valid: true},
+		Action:       resolutionDelete,
+		ChirpID:      uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+	})
+	w.WriteHeader(204)
+}
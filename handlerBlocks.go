@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+// RelatedUser is someone the caller has blocked or muted.
+type RelatedUser struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// decodeRelatedUser reads the user to block or mute from the request body.
+// It writes the error response and returns false on failure.
+func (cfg *apiConfig) decodeRelatedUser(w http.ResponseWriter, r *http.Request, callerID uuid.UUID) (uuid.UUID, bool) {
+	var params struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return uuid.Nil, false
+	}
+	if params.UserID == callerID {
+		respondWithError(w, 400, "You can't do that to yourself", nil)
+		return uuid.Nil, false
+	}
+	if _, err := cfg.dbQueries.GetUserByID(r.Context(), params.UserID); err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return uuid.Nil, false
+	}
+	return params.UserID, true
+}
+
+func (cfg *apiConfig) handlerGetBlocks(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	blocks, err := cfg.dbQueries.GetUserBlocks(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve blocks", err)
+		return
+	}
+	resp := []RelatedUser{}
+	for _, block := range blocks {
+		resp = append(resp, RelatedUser{UserID: block.BlockedID, CreatedAt: block.CreatedAt})
+	}
+	respondWithJson(w, 200, resp)
+}
+
+// handlerBlockUser hides the caller's and the other user's chirps from each
+// other. Blocking someone already blocked is not an error.
+func (cfg *apiConfig) handlerBlockUser(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	userID, ok := cfg.decodeRelatedUser(w, r, principal.UserID)
+	if !ok {
+		return
+	}
+	block, err := cfg.dbQueries.CreateUserBlock(r.Context(), database.CreateUserBlockParams{
+		BlockerID: principal.UserID,
+		BlockedID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't block user", err)
+		return
+	}
+	respondWithJson(w, 201, RelatedUser{UserID: block.BlockedID, CreatedAt: block.CreatedAt})
+}
+
+func (cfg *apiConfig) handlerUnblockUser(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid user ID", err)
+		return
+	}
+	deleted, err := cfg.dbQueries.DeleteUserBlock(r.Context(), database.DeleteUserBlockParams{
+		BlockerID: principal.UserID,
+		BlockedID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't unblock user", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "User isn't blocked", nil)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handlerGetMutes(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	mutes, err := cfg.dbQueries.GetUserMutes(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve mutes", err)
+		return
+	}
+	resp := []RelatedUser{}
+	for _, mute := range mutes {
+		resp = append(resp, RelatedUser{UserID: mute.MutedID, CreatedAt: mute.CreatedAt})
+	}
+	respondWithJson(w, 200, resp)
+}
+
+// handlerMuteUser leaves the other user's chirps out of the caller's
+// timeline. The muted user isn't affected and their chirps can still be
+// listed with ?author_id=.
+func (cfg *apiConfig) handlerMuteUser(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	userID, ok := cfg.decodeRelatedUser(w, r, principal.UserID)
+	if !ok {
+		return
+	}
+	mute, err := cfg.dbQueries.CreateUserMute(r.Context(), database.CreateUserMuteParams{
+		MuterID: principal.UserID,
+		MutedID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't mute user", err)
+		return
+	}
+	respondWithJson(w, 201, RelatedUser{UserID: mute.MutedID, CreatedAt: mute.CreatedAt})
+}
+
+func (cfg *apiConfig) handlerUnmuteUser(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid user ID", err)
+		return
+	}
+	deleted, err := cfg.dbQueries.DeleteUserMute(r.Context(), database.DeleteUserMuteParams{
+		MuterID: principal.UserID,
+		MutedID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't unmute user", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "User isn't muted", nil)
+		return
+	}
+	w.WriteHeader(204)
+}
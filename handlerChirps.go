@@ -1,17 +1,17 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/hconn7/Chirpy/internal/auth"
 	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/filter"
 )
 
 type Request struct {
@@ -33,46 +33,56 @@ type ErrorResponse struct {
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	request := Request{}
-	err := decoder.Decode(&request)
-	fmt.Printf("Request body: %+v\n", request)
-	fmt.Printf("User ID Type: %T, Value: %s\n", request.UserID, request.UserID)
-
-	if err != nil {
-
-		w.WriteHeader(500)
-
+	if err := decoder.Decode(&request); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
 	}
-	deProfane := CheckProfanityChirp(request.Body)
 
 	if len(request.Body) >= 140 {
-		respondWithError(w, 400, "Chirp length is too long", err)
+		respondWithError(w, 400, "Chirp length is too long", nil)
+		return
 	}
-	if err != nil {
-
-		respondWithError(w, 400, "Error Marshaling Response", err)
-
+	filtered := cfg.chirpFilter().Check(request.Body)
+	if filtered.Has(filter.ActionReject) {
+		respondWithError(w, 400, "Chirp contains words that aren't allowed", nil)
+		return
 	}
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, 401, "No token", err)
+	var flaggedAt sql.NullTime
+	if filtered.Has(filter.ActionFlag) {
+		flaggedAt = sql.NullTime{Time: time.Now(), Valid: true}
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.JwtSecret)
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	userID := principal.UserID
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
 	if err != nil {
-		respondWithError(w, 401, "Token not validated", err)
+		respondWithError(w, 401, "User not found", err)
+		return
+	}
+	if !checkNotSuspended(w, user) {
+		return
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(w, 403, "Verify your email address before chirping", nil)
+		return
 	}
 
 	newChirp, err := cfg.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   deProfane,
-		UserID: userID,
+		Body:      filtered.Text,
+		UserID:    userID,
+		FlaggedAt: flaggedAt,
 	})
-	fmt.Println("Chirp Created\n", newChirp.Body, newChirp.ID)
 	if err != nil {
 		respondWithError(w, 500, "Error creating chirp", err)
 		return
 	}
-
-	fmt.Println(newChirp.Body)
+	if flaggedAt.Valid {
+		cfg.flagChirpForReview(r.Context(), newChirp, filtered.Phrases(filter.ActionFlag))
+	}
+	if !isShadowBanned(user, time.Now()) {
+		cfg.publishChirpEvent(r.Context(), chirpEventCreated, newChirp)
+	}
 
 	respondWithJson(w, 201, Chirp{
 		ID:        newChirp.ID,
@@ -86,23 +96,37 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request) {
 	s := r.URL.Query().Get("author_id")
 	sortHeader := r.URL.Query().Get("sort")
-	chirpsSlice, err := cfg.dbQueries.GetAllChirps(r.Context())
+	viewer, _ := auth.PrincipalFromContext(r.Context())
+	chirpsSlice, err := cfg.dbQueries.GetVisibleChirps(r.Context(), viewer.UserID)
 	if err != nil {
 		respondWithError(w, 500, "Error retreiving Chirps", err)
+		return
+	}
+	muted, err := cfg.mutedWordsFor(r.Context(), viewer.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve muted words", err)
+		return
 	}
 	if s != "" {
 		id, err := uuid.Parse(s)
 		if err != nil {
-			fmt.Println("Error parsing UUID:", err)
+			respondWithError(w, 400, "Invalid author ID", err)
 			return
 		}
-		chirps, err := cfg.dbQueries.GetChirpByUserID(r.Context(), id)
+		chirps, err := cfg.dbQueries.GetVisibleChirpsByUserID(r.Context(), database.GetVisibleChirpsByUserIDParams{
+			UserID:   id,
+			ViewerID: viewer.UserID,
+		})
 		if err != nil {
-			respondWithError(w, 401, "user doesn't exist", err)
+			respondWithError(w, 500, "Error retreiving Chirps", err)
+			return
 		}
 
 		responeChirps := []Chirp{}
 		for _, chirp := range chirps {
+			if chirp.UserID != viewer.UserID && muted.mutes(chirp.Body) {
+				continue
+			}
 			singleChirp := Chirp{
 				ID:        chirp.ID,
 				CreatedAt: chirp.CreatedAt,
@@ -118,6 +142,9 @@ func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request
 
 		responseChirps := []Chirp{}
 		for _, chirp := range chirpsSlice {
+			if chirp.UserID != viewer.UserID && muted.mutes(chirp.Body) {
+				continue
+			}
 			singleChirp := Chirp{
 				ID:        chirp.ID,
 				CreatedAt: chirp.CreatedAt,
@@ -144,17 +171,19 @@ func (cfg *apiConfig) hanlerGetSingleChirp(w http.ResponseWriter, r *http.Reques
 	id := r.PathValue("chirpID")
 	if id == "" {
 		respondWithError(w, 404, "no Id", errors.New("error"))
-		fmt.Println("No ID in request")
 		return
 	}
-	fmt.Println(id)
 	chirpID, err := uuid.Parse(id)
 	if err != nil {
 		respondWithError(w, 404, "No chirp", err)
 		return
 	}
 
-	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
+	viewer, _ := auth.PrincipalFromContext(r.Context())
+	chirp, err := cfg.dbQueries.GetVisibleChirpByID(r.Context(), database.GetVisibleChirpByIDParams{
+		ID:       chirpID,
+		ViewerID: viewer.UserID,
+	})
 	if err != nil {
 		respondWithError(w, 404, "incorrect id or chirp doesn't exist", err)
 		return
@@ -165,61 +194,25 @@ func (cfg *apiConfig) hanlerGetSingleChirp(w http.ResponseWriter, r *http.Reques
 		CreatedAt: chirp.CreatedAt,
 		UpdatedAt: chirp.UpdatedAt,
 		Body:      chirp.Body,
-		UserID:    chirp.ID,
+		UserID:    chirp.UserID,
 	})
 
 }
 
-func CheckProfanityChirp(chirps ...string) string {
-	badWords := []string{"kerfuffle", "sharbert", "fornax"}
-	var cleanedChirps []string
-
-	for _, chirp := range chirps {
-		words := strings.Split(chirp, " ")
-
-		for i, word := range words {
-			loweredWord := strings.ToLower(word)
-
-			for _, badWord := range badWords {
-				if loweredWord == badWord {
-					words[i] = "****"
-				}
-			}
-		}
-
-		cleanedChirps = append(cleanedChirps, strings.Join(words, " "))
-	}
-
-	return strings.Join(cleanedChirps, " ")
-}
-
 func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("chirpID")
-	if id == "" {
-		fmt.Println("No ID in request")
-	}
-	fmt.Println(id)
 	chirpID, err := uuid.Parse(id)
 	if err != nil {
 		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, 401, "No auth header", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.JwtSecret)
-	if err != nil {
-		respondWithError(w, 401, "JWT invalid", err)
-		return
-	}
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	userID := principal.UserID
 
 	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
 	if err != nil {
 		respondWithError(w, 404, "No chirp found", err)
-		fmt.Println("Couln't find chirp with id:", chirpID)
 		return
 	}
 
@@ -232,6 +225,7 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, 404, "issue deleting chirp", err)
 		return
 	}
+	cfg.publishChirpEvent(r.Context(), chirpEventDeleted, chirp)
 	respondWithJson(w, 204, "")
 
 }
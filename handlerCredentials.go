@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/mailer"
+)
+
+var (
+	errInvalidEmail   = errors.New("Invalid email address")
+	errEmailUnchanged = errors.New("That is already your email address")
+	errEmailTaken     = errors.New("Email address is already in use")
+)
+
+// reauthenticate makes a signed-in user prove it's really them before a
+// sensitive change, so a stolen access token alone isn't enough. Wrong
+// guesses count towards the login lockout. It writes the error response and
+// returns false on failure. If 2FA is on, code may be a TOTP code or a
+// recovery code. Accounts made through a provider have no password until
+// they set one with a password reset.
+func (cfg *apiConfig) reauthenticate(w http.ResponseWriter, r *http.Request, user database.User, password, code string) bool {
+	account, ip := loginAccount(user.Email), clientIP(r)
+	if !cfg.checkLoginAllowed(w, account, ip) {
+		return false
+	}
+	if user.HashedPassword == "" {
+		respondWithError(w, 403, "This account has no password yet, set one through POST /api/password-reset/request first", nil)
+		return false
+	}
+	if err := cfg.Passwords.Verify(user.HashedPassword, password); err != nil {
+		cfg.LoginGuard.RecordFailure(account, ip)
+		respondWithError(w, 401, "Current password is incorrect", err)
+		return false
+	}
+	if user.TotpEnabled && !cfg.checkSecondFactor(r, user, code) {
+		cfg.LoginGuard.RecordFailure(account, ip)
+		respondWithError(w, 401, "Invalid two-factor code", nil)
+		return false
+	}
+	cfg.LoginGuard.RecordSuccess(account, ip)
+	return true
+}
+
+// emailChangeError maps the errors from requestEmailChange to a response.
+func emailChangeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidEmail), errors.Is(err, errEmailUnchanged):
+		respondWithError(w, 400, err.Error(), nil)
+	case errors.Is(err, errEmailTaken):
+		respondWithError(w, 409, err.Error(), nil)
+	default:
+		respondWithError(w, 500, "Couldn't send confirmation email", err)
+	}
+}
+
+// checkNewEmail reports why a user can't move to newEmail, if anything.
+func (cfg *apiConfig) checkNewEmail(ctx context.Context, user database.User, newEmail string) error {
+	if !validEmail(newEmail) {
+		return errInvalidEmail
+	}
+	if newEmail == user.Email {
+		return errEmailUnchanged
+	}
+	if _, err := cfg.dbQueries.GetUserByEmail(ctx, newEmail); err == nil {
+		return errEmailTaken
+	}
+	return nil
+}
+
+// requestEmailChange mails a confirmation token to the new address. The
+// account keeps its current address until the token is used, and the
+// current address is told about the request in case it wasn't the owner.
+// The token is stored through q so it can be part of a larger transaction.
+func (cfg *apiConfig) requestEmailChange(ctx context.Context, q *database.Queries, user database.User, newEmail string) error {
+	if err := cfg.checkNewEmail(ctx, user, newEmail); err != nil {
+		return err
+	}
+
+	verification, err := q.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+		UserID: user.ID,
+		Email:  newEmail,
+	})
+	if err != nil {
+		return err
+	}
+	token, err := cfg.JwtKeys.MakeSingleUseJWT(user.ID, auth.EmailChangeAudience, verification.ID, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Mailer.Send(ctx, mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Chirpy email address",
+		Body: fmt.Sprintf("Confirm moving your Chirpy account to this address by sending this token to POST /api/users/email/confirm:\n%s\n\n"+
+			"The token expires in 24 hours.", token),
+	}); err != nil {
+		return err
+	}
+
+	if err := cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy email address is being changed",
+		Body: fmt.Sprintf("Someone asked to move your Chirpy account to %s.\n\n"+
+			"Nothing changes until the new address is confirmed. If this wasn't you, "+
+			"change your password now.", newEmail),
+	}); err != nil {
+		log.Printf("Couldn't notify %s of email change: %v", user.Email, err)
+	}
+	return nil
+}
+
+// revokeAllCredentials signs a user out of every session, personal access
+// token and OAuth app. q lets callers do it inside a transaction.
+func revokeAllCredentials(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	if err := q.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := q.RevokeAllPersonalAccessTokensForUser(ctx, userID); err != nil {
+		return err
+	}
+	return q.RevokeOAuthRefreshTokensForUser(ctx, userID)
+}
+
+// changePassword stores a new password and signs the user out of every
+// session, token and app, since one of them may be why the password is
+// being changed. Callers give the user a fresh session.
+func (cfg *apiConfig) changePassword(ctx context.Context, user database.User, password string) error {
+	hashed, err := cfg.Passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := cfg.inTx(ctx, func(q *database.Queries) error {
+		return storePassword(ctx, q, user.ID, hashed)
+	}); err != nil {
+		return err
+	}
+	cfg.passwordChanged(ctx, user)
+	return nil
+}
+
+// storePassword is the database side of changePassword, for callers that
+// make other changes in the same transaction. Once it has committed they
+// call passwordChanged.
+func storePassword(ctx context.Context, q *database.Queries, userID uuid.UUID, hashed string) error {
+	if err := q.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashed,
+	}); err != nil {
+		return err
+	}
+	return revokeAllCredentials(ctx, q, userID)
+}
+
+// passwordChanged audits a password change and tells the owner about it.
+func (cfg *apiConfig) passwordChanged(ctx context.Context, user database.User) {
+	cfg.audit(ctx, "password.changed", uuid.NullUUID{UUID: user.ID, Valid: true}, user.ID.String(), "")
+
+	if err := cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy password was changed",
+		Body: "The password for your Chirpy account was just changed and all other sessions were signed out.\n\n" +
+			"If this wasn't you, reset your password now.",
+	}); err != nil {
+		log.Printf("Couldn't notify %s of password change: %v", user.Email, err)
+	}
+}
+
+func (cfg *apiConfig) handlerChangeEmail(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+	}
+	type Response struct {
+		Email        string `json:"email"`
+		PendingEmail string `json:"pending_email"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	if !cfg.reauthenticate(w, r, user, params.CurrentPassword, params.Code) {
+		return
+	}
+	if err := cfg.requestEmailChange(r.Context(), cfg.dbQueries, user, params.Email); err != nil {
+		emailChangeError(w, err)
+		return
+	}
+
+	respondWithJson(w, 202, Response{Email: user.Email, PendingEmail: params.Email})
+}
+
+func (cfg *apiConfig) handlerConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Token string `json:"token"`
+	}
+	type Response struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+
+	claims, err := cfg.JwtKeys.ParseJWT(params.Token, auth.EmailChangeAudience)
+	if err != nil {
+		respondWithError(w, 400, "Confirmation token invalid or expired", err)
+		return
+	}
+	verificationID, err := uuid.Parse(claims.TokenID)
+	if err != nil {
+		respondWithError(w, 400, "Confirmation token invalid or expired", err)
+		return
+	}
+	verification, err := cfg.dbQueries.GetEmailVerification(r.Context(), verificationID)
+	if err != nil || verification.UserID != claims.UserID {
+		respondWithError(w, 400, "Confirmation token invalid or expired", err)
+		return
+	}
+
+	used, err := cfg.dbQueries.UseEmailVerification(r.Context(), verification.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't use confirmation token", err)
+		return
+	}
+	if used == 0 {
+		respondWithError(w, 400, "Confirmation token already used", nil)
+		return
+	}
+	err = cfg.dbQueries.UpdateUserEmail(r.Context(), database.UpdateUserEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, errEmailTaken.Error(), nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Couldn't change email", err)
+		return
+	}
+	cfg.audit(r.Context(), "email.changed", uuid.NullUUID{UUID: verification.UserID, Valid: true}, verification.UserID.String(), verification.Email)
+	cfg.bootstrapAdmin(r.Context())
+
+	respondWithJson(w, 200, Response{Email: verification.Email, EmailVerified: true})
+}
+
+// handlerChangePassword signs out every other session and answers with a
+// fresh session for the caller.
+func (cfg *apiConfig) handlerChangePassword(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+		Code            string `json:"code"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	if !cfg.reauthenticate(w, r, user, params.CurrentPassword, params.Code) {
+		return
+	}
+	if err := cfg.PasswordPolicy.Validate(params.NewPassword); err != nil {
+		respondWithError(w, 400, err.Error(), nil)
+		return
+	}
+	if err := cfg.changePassword(r.Context(), user, params.NewPassword); err != nil {
+		respondWithError(w, 500, "Couldn't change password", err)
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/filter"
+	"github.com/lib/pq"
+)
+
+type FilterRule struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	List      string     `json:"list"`
+	Phrase    string     `json:"phrase"`
+	Action    string     `json:"action"`
+	CreatedBy *uuid.UUID `json:"created_by"`
+}
+
+func toFilterRule(rule database.FilterRule) FilterRule {
+	resp := FilterRule{
+		ID:        rule.ID,
+		CreatedAt: rule.CreatedAt,
+		UpdatedAt: rule.UpdatedAt,
+		List:      rule.List,
+		Phrase:    rule.Phrase,
+		Action:    rule.Action,
+	}
+	if rule.CreatedBy.Valid {
+		resp.CreatedBy = &rule.CreatedBy.UUID
+	}
+	return resp
+}
+
+type filterRuleParams struct {
+	List   string `json:"list"`
+	Phrase string `json:"phrase"`
+	Action string `json:"action"`
+}
+
+// decodeFilterRule reads and normalizes a rule from the request body. It
+// writes the error response and returns false if the rule is invalid.
+func decodeFilterRule(w http.ResponseWriter, r *http.Request) (filterRuleParams, bool) {
+	var params filterRuleParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return params, false
+	}
+	params.List = strings.TrimSpace(params.List)
+	if params.List == "" {
+		params.List = "default"
+	}
+	params.Phrase = filter.Normalize(params.Phrase)
+	if params.Phrase == "" {
+		respondWithError(w, 400, "Phrase must contain at least one word", nil)
+		return params, false
+	}
+	if !filter.ValidAction(params.Action) {
+		respondWithError(w, 400, "Action must be mask, flag or reject", nil)
+		return params, false
+	}
+	return params, true
+}
+
+// filterRulesChanged recompiles the filter so a change applies to the next
+// chirp. Other instances pick it up on their next periodic reload.
+func (cfg *apiConfig) filterRulesChanged(r *http.Request) {
+	if err := cfg.reloadChirpFilter(r.Context()); err != nil {
+		log.Printf("Couldn't reload chirp filter: %v", err)
+	}
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// handlerGetFilterRules lists every rule, or those of one list with ?list=.
+func (cfg *apiConfig) handlerGetFilterRules(w http.ResponseWriter, r *http.Request) {
+	list := r.URL.Query().Get("list")
+	rules, err := cfg.dbQueries.GetFilterRules(r.Context())
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve filter rules", err)
+		return
+	}
+	resp := []FilterRule{}
+	for _, rule := range rules {
+		if list == "" || rule.List == list {
+			resp = append(resp, toFilterRule(rule))
+		}
+	}
+	respondWithJson(w, 200, resp)
+}
+
+func (cfg *apiConfig) handlerCreateFilterRule(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeFilterRule(w, r)
+	if !ok {
+		return
+	}
+	actor, _ := actorFromContext(r.Context())
+
+	rule, err := cfg.dbQueries.CreateFilterRule(r.Context(), database.CreateFilterRuleParams{
+		List:      params.List,
+		Phrase:    params.Phrase,
+		Action:    params.Action,
+		CreatedBy: uuid.NullUUID{UUID: actor.ID, Valid: true},
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "That phrase is already in the list", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Couldn't create filter rule", err)
+		return
+	}
+	cfg.audit(r.Context(), "filter.created", uuid.NullUUID{UUID: actor.ID, Valid: true}, rule.ID.String(), rule.List+": "+rule.Phrase+" -> "+rule.Action)
+	cfg.filterRulesChanged(r)
+
+	respondWithJson(w, 201, toFilterRule(rule))
+}
+
+func (cfg *apiConfig) handlerUpdateFilterRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid filter rule ID", err)
+		return
+	}
+	params, ok := decodeFilterRule(w, r)
+	if !ok {
+		return
+	}
+	actor, _ := actorFromContext(r.Context())
+
+	rule, err := cfg.dbQueries.UpdateFilterRule(r.Context(), database.UpdateFilterRuleParams{
+		ID:     id,
+		List:   params.List,
+		Phrase: params.Phrase,
+		Action: params.Action,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, "Filter rule not found", nil)
+		return
+	}
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "That phrase is already in the list", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Couldn't update filter rule", err)
+		return
+	}
+	cfg.audit(r.Context(), "filter.updated", uuid.NullUUID{UUID: actor.ID, Valid: true}, rule.ID.String(), rule.List+": "+rule.Phrase+" -> "+rule.Action)
+	cfg.filterRulesChanged(r)
+
+	respondWithJson(w, 200, toFilterRule(rule))
+}
+
+func (cfg *apiConfig) handlerDeleteFilterRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid filter rule ID", err)
+		return
+	}
+	actor, _ := actorFromContext(r.Context())
+
+	rule, err := cfg.dbQueries.GetFilterRule(r.Context(), id)
+	if err != nil {
+		respondWithError(w, 404, "Filter rule not found", err)
+		return
+	}
+	if _, err := cfg.dbQueries.DeleteFilterRule(r.Context(), id); err != nil {
+		respondWithError(w, 500, "Couldn't delete filter rule", err)
+		return
+	}
+	cfg.audit(r.Context(), "filter.deleted", uuid.NullUUID{UUID: actor.ID, Valid: true}, rule.ID.String(), rule.List+": "+rule.Phrase)
+	cfg.filterRulesChanged(r)
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "net/http"
+
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJson(w, 200, cfg.JwtKeys.JWKS())
+}
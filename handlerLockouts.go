@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/lockout"
+)
+
+// loginAccount is the key failed logins are counted under.
+func loginAccount(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLoginAllowed answers 429 and returns false when the account or IP is
+// throttled or locked out.
+func (cfg *apiConfig) checkLoginAllowed(w http.ResponseWriter, account, ip string) bool {
+	decision := cfg.LoginGuard.Check(account, ip)
+	if decision.Allowed {
+		return true
+	}
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(decision.RetryAfter.Seconds()))))
+	msg := "Too many failed login attempts, slow down"
+	if decision.Locked {
+		msg = "Too many failed login attempts, temporarily locked"
+	}
+	respondWithError(w, 429, msg, nil)
+	return false
+}
+
+func (cfg *apiConfig) handlerGetLockouts(w http.ResponseWriter, r *http.Request) {
+	respondWithJson(w, 200, cfg.LoginGuard.Statuses())
+}
+
+func (cfg *apiConfig) handlerUnlock(w http.ResponseWriter, r *http.Request) {
+	kind := lockout.Kind(r.PathValue("kind"))
+	if kind != lockout.KindAccount && kind != lockout.KindIP {
+		respondWithError(w, 400, "Kind must be account or ip", nil)
+		return
+	}
+	if !cfg.LoginGuard.Unlock(kind, r.PathValue("key")) {
+		respondWithError(w, 404, "Nothing tracked for that key", nil)
+		return
+	}
+	if actor, ok := actorFromContext(r.Context()); ok {
+		cfg.audit(r.Context(), "login.unlocked_by_admin", uuid.NullUUID{UUID: actor.ID, Valid: true}, r.PathValue("key"), string(kind))
+	}
+	w.WriteHeader(204)
+}
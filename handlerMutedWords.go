@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/filter"
+)
+
+const (
+	mutedWordKindWord    = "word"
+	mutedWordKindHashtag = "hashtag"
+)
+
+// maxMutedWords caps how many words a user can mute, since every one is
+// checked against every chirp they read.
+const maxMutedWords = 200
+
+type MutedWord struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Kind      string     `json:"kind"`
+	Phrase    string     `json:"phrase"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func toMutedWord(word database.MutedWord) MutedWord {
+	resp := MutedWord{
+		ID:        word.ID,
+		CreatedAt: word.CreatedAt,
+		Kind:      word.Kind,
+		Phrase:    word.Phrase,
+		ExpiresAt: nullTimePtr(word.ExpiresAt),
+	}
+	if word.Kind == mutedWordKindHashtag {
+		resp.Phrase = "#" + word.Phrase
+	}
+	return resp
+}
+
+// mutedWords decides which chirps a reader has muted by keyword. A word
+// mute also catches the word used as a hashtag; a hashtag mute only catches
+// the hashtag.
+type mutedWords struct {
+	words    *filter.Matcher
+	hashtags map[string]bool
+}
+
+// mutes reports whether a chirp body contains anything the reader muted.
+func (m mutedWords) mutes(body string) bool {
+	if m.words != nil && m.words.Len() > 0 && len(m.words.Check(body).Matches) > 0 {
+		return true
+	}
+	for _, tag := range filter.Hashtags(body) {
+		if m.hashtags[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// mutedWordsFor loads the reader's active muted words. Anonymous readers
+// have none.
+func (cfg *apiConfig) mutedWordsFor(ctx context.Context, userID uuid.UUID) (mutedWords, error) {
+	m := mutedWords{words: filter.Compile(nil), hashtags: map[string]bool{}}
+	if userID == uuid.Nil {
+		return m, nil
+	}
+	rows, err := cfg.dbQueries.GetActiveMutedWords(ctx, userID)
+	if err != nil {
+		return m, err
+	}
+	var rules []filter.Rule
+	for _, row := range rows {
+		if row.Kind == mutedWordKindHashtag {
+			m.hashtags[row.Phrase] = true
+			continue
+		}
+		// Only whether a muted word matched matters, not the action.
+		rules = append(rules, filter.Rule{Phrase: row.Phrase, Action: filter.ActionFlag})
+	}
+	m.words = filter.Compile(rules)
+	return m, nil
+}
+
+func (cfg *apiConfig) handlerGetMutedWords(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	words, err := cfg.dbQueries.GetActiveMutedWords(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve muted words", err)
+		return
+	}
+	resp := []MutedWord{}
+	for _, word := range words {
+		resp = append(resp, toMutedWord(word))
+	}
+	respondWithJson(w, 200, resp)
+}
+
+// handlerMuteWord mutes a word, phrase or, with a leading '#', a hashtag,
+// optionally only for a while. Muting the same phrase again replaces its
+// expiry.
+func (cfg *apiConfig) handlerMuteWord(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Phrase    string `json:"phrase"`
+		ExpiresIn string `json:"expires_in"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	kind, phrase := mutedWordKindWord, filter.Normalize(params.Phrase)
+	if strings.HasPrefix(strings.TrimSpace(params.Phrase), "#") {
+		kind, phrase = mutedWordKindHashtag, filter.NormalizeHashtag(params.Phrase)
+	}
+	if phrase == "" {
+		respondWithError(w, 400, "Phrase must be a word, phrase or hashtag", nil)
+		return
+	}
+	var expiresAt sql.NullTime
+	if params.ExpiresIn != "" {
+		d, err := parseRestrictionDuration(params.ExpiresIn)
+		if err != nil {
+			respondWithError(w, 400, "expires_in "+err.Error(), nil)
+			return
+		}
+		expiresAt = sql.NullTime{Time: time.Now().Add(d), Valid: true}
+	}
+
+	existing, err := cfg.dbQueries.GetActiveMutedWords(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve muted words", err)
+		return
+	}
+	if len(existing) >= maxMutedWords {
+		respondWithError(w, 409, "Too many muted words, remove some first", nil)
+		return
+	}
+
+	word, err := cfg.dbQueries.CreateMutedWord(r.Context(), database.CreateMutedWordParams{
+		UserID:    principal.UserID,
+		Kind:      kind,
+		Phrase:    phrase,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't mute word", err)
+		return
+	}
+	respondWithJson(w, 201, toMutedWord(word))
+}
+
+func (cfg *apiConfig) handlerUnmuteWord(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid muted word ID", err)
+		return
+	}
+	deleted, err := cfg.dbQueries.DeleteMutedWord(r.Context(), database.DeleteMutedWordParams{
+		ID:     id,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't unmute word", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "Muted word not found", nil)
+		return
+	}
+	w.WriteHeader(204)
+}
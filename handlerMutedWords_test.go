@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hconn7/Chirpy/internal/filter"
+)
+
+func TestMutedWords(t *testing.T) {
+	muted := mutedWords{
+		words:    filter.Compile([]filter.Rule{{Phrase: "spoilers", Action: filter.ActionFlag}}),
+		hashtags: map[string]bool{"finale": true},
+	}
+	var tests = []struct {
+		chirp string
+		want  bool
+	}{
+		{"no SPOILERS please", true},
+		{"#spoilers ahead", true},
+		{"what a #Finale", true},
+		{"the finale was great", false},
+		{"nothing to see", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.chirp, func(t *testing.T) {
+			if got := muted.mutes(tt.chirp); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+type Notification struct {
+	ID        uuid.UUID   `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Type      string      `json:"type"`
+	Summary   string      `json:"summary"`
+	ChirpID   *uuid.UUID  `json:"chirp_id"`
+	ActorIDs  []uuid.UUID `json:"actor_ids"`
+	Count     int32       `json:"count"`
+	Details   string      `json:"details"`
+	ReadAt    *time.Time  `json:"read_at"`
+}
+
+func toNotification(n database.Notification) Notification {
+	actorIDs := n.ActorIds
+	if actorIDs == nil {
+		actorIDs = []uuid.UUID{}
+	}
+	return Notification{
+		ID:        n.ID,
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+		Type:      n.Type,
+		Summary:   notificationSummary(n),
+		ChirpID:   nullUUIDPtr(n.ChirpID),
+		ActorIDs:  actorIDs,
+		Count:     n.Count,
+		Details:   n.Details,
+		ReadAt:    nullTimePtr(n.ReadAt),
+	}
+}
+
+// encodeNotificationCursor points just past n in the newest-first list.
+func encodeNotificationCursor(n database.Notification) string {
+	s := n.CreatedAt.Format(time.RFC3339Nano) + "|" + n.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeNotificationCursor(cursor string) (time.Time, uuid.UUID, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, false
+	}
+	at, id, ok := strings.Cut(string(data), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, false
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, uuid.Nil, false
+	}
+	notificationID, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, false
+	}
+	return createdAt, notificationID, true
+}
+
+// handlerGetNotifications lists the caller's notifications, newest first, a
+// page at a time. Pass next_cursor back as ?cursor= for the next page;
+// ?unread=true leaves out those already read.
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	type Response struct {
+		Notifications []Notification `json:"notifications"`
+		UnreadCount   int64          `json:"unread_count"`
+		NextCursor    string         `json:"next_cursor,omitempty"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	query := r.URL.Query()
+	limit := 20
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 && n <= 100 {
+		limit = n
+	}
+	params := database.GetNotificationsParams{
+		UserID:     principal.UserID,
+		UnreadOnly: query.Get("unread") == "true",
+		MaxResults: int32(limit),
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		createdAt, id, ok := decodeNotificationCursor(cursor)
+		if !ok {
+			respondWithError(w, 400, "Invalid cursor", nil)
+			return
+		}
+		params.BeforeCreatedAt.Time, params.BeforeCreatedAt.Valid = createdAt, true
+		params.BeforeID.UUID, params.BeforeID.Valid = id, true
+	}
+
+	notifications, err := cfg.dbQueries.GetNotifications(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve notifications", err)
+		return
+	}
+	unread, err := cfg.dbQueries.CountUnreadNotifications(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't count unread notifications", err)
+		return
+	}
+	resp := Response{Notifications: []Notification{}, UnreadCount: unread}
+	for _, n := range notifications {
+		resp.Notifications = append(resp.Notifications, toNotification(n))
+	}
+	if len(notifications) == limit {
+		resp.NextCursor = encodeNotificationCursor(notifications[len(notifications)-1])
+	}
+	respondWithJson(w, 200, resp)
+}
+
+func (cfg *apiConfig) handlerMarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid notification ID", err)
+		return
+	}
+	updated, err := cfg.dbQueries.MarkNotificationRead(r.Context(), database.MarkNotificationReadParams{
+		ID:     id,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't mark notification read", err)
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, 404, "Notification not found", nil)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handlerMarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	if _, err := cfg.dbQueries.MarkAllNotificationsRead(r.Context(), principal.UserID); err != nil {
+		respondWithError(w, 500, "Couldn't mark notifications read", err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// notificationPreferences returns whether each type is on for the user.
+// Types the user never changed are on.
+func (cfg *apiConfig) notificationPreferences(r *http.Request, userID uuid.UUID) (map[string]bool, error) {
+	prefs := map[string]bool{}
+	for _, t := range notificationTypes {
+		prefs[t] = true
+	}
+	rows, err := cfg.dbQueries.GetNotificationPreferences(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		prefs[row.Type] = row.Enabled
+	}
+	return prefs, nil
+}
+
+func (cfg *apiConfig) handlerGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	prefs, err := cfg.notificationPreferences(r, principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve notification preferences", err)
+		return
+	}
+	respondWithJson(w, 200, prefs)
+}
+
+// handlerUpdateNotificationPreferences turns notification types on or off,
+// e.g. {"like": false}. Types left out keep their setting.
+func (cfg *apiConfig) handlerUpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var params map[string]bool
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	for t := range params {
+		if !isNotificationType(t) {
+			respondWithError(w, 400, "Unknown notification type "+t, nil)
+			return
+		}
+	}
+	for t, enabled := range params {
+		err := cfg.dbQueries.SetNotificationPreference(r.Context(), database.SetNotificationPreferenceParams{
+			UserID:  principal.UserID,
+			Type:    t,
+			Enabled: enabled,
+		})
+		if err != nil {
+			respondWithError(w, 500, "Couldn't update notification preferences", err)
+			return
+		}
+	}
+
+	prefs, err := cfg.notificationPreferences(r, principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve notification preferences", err)
+		return
+	}
+	respondWithJson(w, 200, prefs)
+}
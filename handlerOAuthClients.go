@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/oauth"
+)
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+func toOAuthClient(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Public:       !client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, 400, "Client name is required", nil)
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		respondWithError(w, 400, "At least one redirect URI is required", nil)
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if err := oauth.ValidRedirectURI(uri); err != nil {
+			respondWithError(w, 400, err.Error()+": "+uri, nil)
+			return
+		}
+	}
+	if len(params.Scopes) == 0 {
+		respondWithError(w, 400, "At least one scope is required", nil)
+		return
+	}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(auth.ThirdPartyScopes, scope) {
+			respondWithError(w, 400, "Scope not allowed for OAuth clients: "+scope, nil)
+			return
+		}
+	}
+
+	var secret string
+	secretHash := sql.NullString{}
+	if !params.Public {
+		var err error
+		secret, err = oauth.NewClientSecret()
+		if err != nil {
+			respondWithError(w, 500, "Couldn't make client secret", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.dbQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      principal.UserID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       params.Scopes,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't save client", err)
+		return
+	}
+
+	// The secret is only ever shown in this response.
+	resp := toOAuthClient(client)
+	resp.Secret = secret
+	respondWithJson(w, 201, resp)
+}
+
+func (cfg *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	clients, err := cfg.dbQueries.GetOAuthClientsByOwnerID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve clients", err)
+		return
+	}
+
+	resp := []OAuthClient{}
+	for _, client := range clients {
+		resp = append(resp, toOAuthClient(client))
+	}
+	respondWithJson(w, 200, resp)
+}
+
+// handlerRevokeOAuthClient disables a client for good. Its refresh tokens
+// are revoked with it and access tokens it already holds stop being
+// accepted, see authenticate.
+func (cfg *apiConfig) handlerRevokeOAuthClient(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid client ID", err)
+		return
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	revoked, err := cfg.dbQueries.RevokeOAuthClient(r.Context(), database.RevokeOAuthClientParams{
+		ID:      clientID,
+		OwnerID: principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't revoke client", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "No active client found", nil)
+		return
+	}
+	if err := cfg.dbQueries.RevokeOAuthRefreshTokensForClient(r.Context(), clientID); err != nil {
+		respondWithError(w, 500, "Couldn't revoke client tokens", err)
+		return
+	}
+	cfg.audit(r.Context(), "oauth.client_revoked", uuid.NullUUID{UUID: principal.UserID, Valid: true}, clientID.String(), "")
+	w.WriteHeader(204)
+}
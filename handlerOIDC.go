@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/oidc"
+)
+
+// oidcStateCookie carries the state, nonce and PKCE verifier from the
+// redirect to the provider until its callback.
+const oidcStateCookie = "chirpy_oidc_state"
+
+func (cfg *apiConfig) oidcCookie(provider, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/login/oidc/" + provider,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.BaseURL, "https://"),
+		// Lax so the cookie survives the top-level redirect back from the
+		// provider.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	provider, ok := cfg.OIDCProviders[name]
+	if !ok {
+		respondWithError(w, 404, "Unknown identity provider", nil)
+		return
+	}
+
+	state, err := oidc.NewLoginState()
+	if err != nil {
+		respondWithError(w, 500, "Couldn't start login", err)
+		return
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), state)
+	if err != nil {
+		respondWithError(w, 502, "Couldn't reach the identity provider", err)
+		return
+	}
+	http.SetCookie(w, cfg.oidcCookie(name, state.Encode(), 600))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handlerOIDCCallback signs in the user the provider vouches for. A known
+// identity logs straight in. Otherwise the identity is linked to the account
+// with the same verified email, or a new account is created for it.
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	provider, ok := cfg.OIDCProviders[name]
+	if !ok {
+		respondWithError(w, 404, "Unknown identity provider", nil)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		respondWithError(w, 400, "Login session expired, please start again", err)
+		return
+	}
+	http.SetCookie(w, cfg.oidcCookie(name, "", -1))
+	state, err := oidc.DecodeLoginState(cookie.Value)
+	if err != nil {
+		respondWithError(w, 400, "Login session expired, please start again", err)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		respondWithError(w, 401, "Identity provider refused the login: "+providerErr, nil)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		respondWithError(w, 400, "Login state doesn't match", nil)
+		return
+	}
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), state)
+	if err != nil {
+		respondWithError(w, 401, "Couldn't verify the identity provider's response", err)
+		return
+	}
+
+	link, err := cfg.dbQueries.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		user, err := cfg.dbQueries.GetUserByID(r.Context(), link.UserID)
+		if err != nil {
+			respondWithError(w, 401, "Linked account no longer exists", err)
+			return
+		}
+		if err := cfg.dbQueries.TouchUserIdentity(r.Context(), link.ID); err != nil {
+			respondWithError(w, 500, "Couldn't update identity", err)
+			return
+		}
+		cfg.completeLogin(w, r, user)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 500, "Couldn't look up identity", err)
+		return
+	}
+
+	// Linking by email is only safe when both sides have proven they own
+	// the address, otherwise someone could register a victim's address
+	// first and be handed their provider login.
+	if identity.Email == "" || !identity.EmailVerified {
+		respondWithError(w, 403, "The identity provider hasn't verified your email address", nil)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByEmail(r.Context(), identity.Email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = cfg.createOIDCUser(r.Context(), identity.Email)
+		if err != nil {
+			respondWithError(w, 500, "Couldn't create user", err)
+			return
+		}
+	case err != nil:
+		respondWithError(w, 500, "Couldn't look up user", err)
+		return
+	case !user.EmailVerifiedAt.Valid:
+		respondWithError(w, 409, "An account with this email exists but isn't verified yet. Verify it, then sign in again", nil)
+		return
+	}
+
+	if _, err := cfg.dbQueries.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		UserID:  user.ID,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	}); err != nil {
+		respondWithError(w, 500, "Couldn't link identity", err)
+		return
+	}
+	cfg.audit(r.Context(), "oidc.linked", uuid.NullUUID{UUID: user.ID, Valid: true}, user.ID.String(), identity.Issuer+" "+identity.Subject)
+	cfg.completeLogin(w, r, user)
+}
+
+// createOIDCUser makes an account for someone who has only ever signed in
+// through a provider. It has no password until the user sets one through a
+// password reset, which reauthenticate points them at.
+func (cfg *apiConfig) createOIDCUser(ctx context.Context, email string) (database.User, error) {
+	user, err := cfg.dbQueries.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: "",
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	if err := cfg.dbQueries.MarkEmailVerified(ctx, user.ID); err != nil {
+		return database.User{}, err
+	}
+	cfg.bootstrapAdmin(ctx)
+	return cfg.dbQueries.GetUserByID(ctx, user.ID)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/lockout"
+	"github.com/hconn7/Chirpy/internal/mailer"
+)
+
+var errResetTokenUsed = errors.New("Reset token already used")
+
+// maxPasswordResetSends is how many reset emails may be in flight at once.
+// Requests beyond that are dropped rather than queued.
+const maxPasswordResetSends = 8
+
+// passwordResetLockoutConfig limits reset requests to a few an hour per
+// email and a few more per IP. Every request counts, not just failures.
+func passwordResetLockoutConfig() lockout.Config {
+	return lockout.Config{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      10,
+		LockoutDuration:    time.Hour,
+		Window:             time.Hour,
+	}
+}
+
+// handlerRequestPasswordReset always answers 202 so the response can't be
+// used to find out which emails have accounts. The lookup and mail happen in
+// the background for the same reason.
+func (cfg *apiConfig) handlerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Email string `json:"email"`
+	}
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+
+	account, ip := loginAccount(params.Email), clientIP(r)
+	if decision := cfg.ResetGuard.Check(account, ip); !decision.Allowed {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(decision.RetryAfter.Seconds()))))
+		respondWithError(w, 429, "Too many password reset requests, try again later", nil)
+		return
+	}
+	cfg.ResetGuard.RecordFailure(account, ip)
+
+	select {
+	case cfg.resetSends <- struct{}{}:
+		go func(email string) {
+			defer func() { <-cfg.resetSends }()
+			if err := cfg.sendPasswordReset(context.Background(), email); err != nil {
+				log.Printf("Password reset for %s not sent: %v", email, err)
+			}
+		}(params.Email)
+	default:
+		log.Printf("Password reset for %s dropped: too many being sent", params.Email)
+	}
+
+	w.WriteHeader(202)
+}
+
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := cfg.dbQueries.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	if err := cfg.dbQueries.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+	}); err != nil {
+		return err
+	}
+
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for this account.\n\n"+
+			"To choose a new one, send this token with it to POST /api/password-reset/confirm:\n%s\n\n"+
+			"The token expires in one hour. If this wasn't you, you can ignore this email.", token),
+	})
+}
+
+func (cfg *apiConfig) handlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	if err := cfg.PasswordPolicy.Validate(params.Password); err != nil {
+		respondWithError(w, 400, err.Error(), nil)
+		return
+	}
+
+	reset, err := cfg.dbQueries.GetPasswordResetByHash(r.Context(), auth.HashToken(params.Token))
+	if err != nil || reset.UsedAt.Valid || time.Now().After(reset.ExpiresAt) {
+		respondWithError(w, 400, "Reset token invalid or expired", err)
+		return
+	}
+	hashedPassword, err := cfg.Passwords.Hash(params.Password)
+	if err != nil {
+		respondWithError(w, 500, "Internal Hashing error", err)
+		return
+	}
+
+	// The token is only used up if the password change goes through.
+	// Whoever had the old password may also hold sessions, tokens or other
+	// reset links, so all of them go.
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		used, err := q.UsePasswordReset(r.Context(), reset.ID)
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errResetTokenUsed
+		}
+		if err := q.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             reset.UserID,
+			HashedPassword: hashedPassword,
+		}); err != nil {
+			return err
+		}
+		if err := q.InvalidatePasswordResets(r.Context(), reset.UserID); err != nil {
+			return err
+		}
+		return revokeAllCredentials(r.Context(), q, reset.UserID)
+	})
+	if errors.Is(err, errResetTokenUsed) {
+		respondWithError(w, 400, "Reset token invalid or expired", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Couldn't reset password", err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
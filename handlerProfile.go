@@ -0,0 +1,270 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/mergepatch"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+type Profile struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	DisplayName   *string   `json:"display_name"`
+	Bio           *string   `json:"bio"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	// Session is only set when a password change signed out every session.
+	Session *SessionTokens `json:"session,omitempty"`
+}
+
+func toProfile(user database.User) Profile {
+	profile := Profile{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		IsChirpyRed:   user.IsChirpyRed,
+	}
+	if user.DisplayName.Valid {
+		profile.DisplayName = &user.DisplayName.String
+	}
+	if user.Bio.Valid {
+		profile.Bio = &user.Bio.String
+	}
+	return profile
+}
+
+// profileETag changes whenever the user row does, since every update bumps
+// updated_at.
+func profileETag(user database.User) string {
+	return `"` + strconv.FormatInt(user.UpdatedAt.UnixMicro(), 36) + `"`
+}
+
+// etagMatches reports whether an If-Match header allows a write to a
+// resource whose current ETag is etag.
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func respondWithProfile(w http.ResponseWriter, code int, user database.User, pendingEmail string, session *SessionTokens) {
+	profile := toProfile(user)
+	profile.PendingEmail = pendingEmail
+	profile.Session = session
+	w.Header().Set("ETag", profileETag(user))
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, code, profile)
+}
+
+func (cfg *apiConfig) handlerGetProfile(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	respondWithProfile(w, 200, user, "", nil)
+}
+
+// validateProfileText checks a free-text profile field and returns the value
+// to store. Blank values are stored as NULL, same as removing the field.
+func validateProfileText(field mergepatch.Field[string], maxLength int, allowNewlines bool) (sql.NullString, string) {
+	if field.Null {
+		return sql.NullString{}, ""
+	}
+	value := strings.TrimSpace(field.Value)
+	if value == "" {
+		return sql.NullString{}, ""
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		return sql.NullString{}, "must be at most " + strconv.Itoa(maxLength) + " characters"
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) && !(allowNewlines && r == '\n') {
+			return sql.NullString{}, "must not contain control characters"
+		}
+	}
+	return sql.NullString{String: value, Valid: true}, ""
+}
+
+// handlerPatchProfile applies a JSON merge patch to the caller's profile.
+// Only the fields present in the body change. Changing email or password
+// needs current_password (and a 2FA code if enabled), and a new email only
+// takes effect once confirmed. Sending If-Match with the ETag from a
+// previous read makes the update fail with 412 if the profile has changed
+// since.
+func (cfg *apiConfig) handlerPatchProfile(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Email           mergepatch.Field[string] `json:"email"`
+		Password        mergepatch.Field[string] `json:"password"`
+		DisplayName     mergepatch.Field[string] `json:"display_name"`
+		Bio             mergepatch.Field[string] `json:"bio"`
+		CurrentPassword string                   `json:"current_password"`
+		Code            string                   `json:"code"`
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergepatch.ContentType && mediaType != "application/json" {
+		respondWithError(w, 415, "Content-Type must be "+mergepatch.ContentType, nil)
+		return
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var params Params
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params: "+err.Error(), err)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, profileETag(user)) {
+		w.Header().Set("ETag", profileETag(user))
+		respondWithError(w, 412, "Profile has changed since it was read", nil)
+		return
+	}
+
+	// Validate every field before touching anything, so a patch is applied
+	// in full or not at all.
+	errs := fieldErrors{}
+	displayName, bio := user.DisplayName, user.Bio
+	if params.DisplayName.Set {
+		var msg string
+		if displayName, msg = validateProfileText(params.DisplayName, maxDisplayNameLength, false); msg != "" {
+			errs["display_name"] = msg
+		}
+	}
+	if params.Bio.Set {
+		var msg string
+		if bio, msg = validateProfileText(params.Bio, maxBioLength, true); msg != "" {
+			errs["bio"] = msg
+		}
+	}
+	changeEmail := params.Email.Set && params.Email.Value != user.Email
+	switch {
+	case !changeEmail:
+	case params.Email.Null:
+		errs["email"] = "can't be removed"
+	case !validEmail(params.Email.Value):
+		errs["email"] = "must be a valid email address"
+	default:
+		if _, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email.Value); err == nil {
+			errs["email"] = "is already in use"
+		}
+	}
+	if params.Password.Set {
+		if params.Password.Null {
+			errs["password"] = "can't be removed"
+		} else if err := cfg.PasswordPolicy.Validate(params.Password.Value); err != nil {
+			errs["password"] = err.Error()
+		}
+	}
+	sensitive := changeEmail || params.Password.Set
+	if sensitive && params.CurrentPassword == "" {
+		errs["current_password"] = "is required to change email or password"
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+	if sensitive && !cfg.reauthenticate(w, r, user, params.CurrentPassword, params.Code) {
+		return
+	}
+	hashed := ""
+	if params.Password.Set {
+		if hashed, err = cfg.Passwords.Hash(params.Password.Value); err != nil {
+			respondWithError(w, 500, "Internal Hashing error", err)
+			return
+		}
+	}
+
+	// Everything is written in one transaction, so a failure part way
+	// leaves the account as it was. The profile update runs even when only
+	// email or password change, because its condition on updated_at is what
+	// guards against a concurrent write.
+	var emailErr error
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if _, err := q.UpdateUserProfile(r.Context(), database.UpdateUserProfileParams{
+			ID:          user.ID,
+			DisplayName: displayName,
+			Bio:         bio,
+			UpdatedAt:   user.UpdatedAt,
+		}); err != nil {
+			return err
+		}
+		if changeEmail {
+			if emailErr = cfg.requestEmailChange(r.Context(), q, user, params.Email.Value); emailErr != nil {
+				return emailErr
+			}
+		}
+		if params.Password.Set {
+			return storePassword(r.Context(), q, user.ID, hashed)
+		}
+		return nil
+	})
+	if emailErr != nil {
+		emailChangeError(w, emailErr)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 412, "Profile has changed since it was read", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Couldn't update profile", err)
+		return
+	}
+	pendingEmail := ""
+	if changeEmail {
+		pendingEmail = params.Email.Value
+	}
+	var session *SessionTokens
+	if params.Password.Set {
+		cfg.passwordChanged(r.Context(), user)
+		newSession, err := cfg.createSession(r, user)
+		if err != nil {
+			respondWithError(w, 500, "Couldn't create session", err)
+			return
+		}
+		session = &newSession
+	}
+
+	updated, err := cfg.dbQueries.GetUserByID(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve profile", err)
+		return
+	}
+	respondWithProfile(w, 200, updated, pendingEmail, session)
+}
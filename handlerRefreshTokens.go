@@ -16,17 +16,36 @@ func (cfg *apiConfig) handlerValidateRefreshToken(w http.ResponseWriter, r *http
 	refreshTok, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithError(w, 401, "Not Refresh Token\n", err)
+		return
 	}
-	tokenDB, err := cfg.dbQueries.GetRefreshTokenByToken(r.Context(), refreshTok)
+	tokenDB, err := cfg.dbQueries.GetRefreshTokenByToken(r.Context(), auth.HashToken(refreshTok))
 	if err != nil {
 		respondWithError(w, 401, "Token not in system\n", err)
+		return
 	}
 	if time.Now().After(tokenDB.ExpiresAt) || tokenDB.RevokedAt.Valid {
 		respondWithError(w, 401, "Token Expired or revoked", nil)
+		return
 	}
-	accessToken, err := auth.MakeJWT(tokenDB.UserID, cfg.JwtSecret, time.Hour)
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), tokenDB.UserID)
+	if err != nil {
+		respondWithError(w, 401, "User not found", err)
+		return
+	}
+	if !checkNotSuspended(w, user) {
+		return
+	}
+	if err := cfg.dbQueries.TouchRefreshToken(r.Context(), database.TouchRefreshTokenParams{
+		TokenHash: tokenDB.TokenHash,
+		IpAddress: clientIP(r),
+	}); err != nil {
+		respondWithError(w, 500, "Couldn't update session", err)
+		return
+	}
+	accessToken, err := cfg.JwtKeys.MakeJWT(tokenDB.UserID, time.Hour)
 	if err != nil {
 		respondWithError(w, 500, "Error making Token\n", err)
+		return
 	}
 	respondWithJson(w, 200, Response{Token: accessToken})
 }
@@ -35,18 +54,24 @@ func (cfg *apiConfig) handlerRevokeRefreshToken(w http.ResponseWriter, r *http.R
 	refreshTok, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithError(w, 401, "Not Refresh Token", err)
+		return
 	}
-	tokenDB, err := cfg.dbQueries.GetRefreshTokenByToken(r.Context(), refreshTok)
+	tokenDB, err := cfg.dbQueries.GetRefreshTokenByToken(r.Context(), auth.HashToken(refreshTok))
 	if err != nil {
 		respondWithError(w, 401, "Token not in system", err)
+		return
 	}
 	err = cfg.dbQueries.UpdateRefreshToken(r.Context(), database.UpdateRefreshTokenParams{
-		Token:     tokenDB.Token,
+		TokenHash: tokenDB.TokenHash,
 		UpdatedAt: time.Now(),
 		RevokedAt: sql.NullTime{
 			Time:  time.Now(),
 			Valid: true,
 		},
 	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't revoke token", err)
+		return
+	}
 	respondWithJson(w, 204, "")
 }
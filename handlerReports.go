@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/mailer"
+)
+
+// reportReasons are the reasons users can give when reporting a chirp.
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "sexual", "self_harm", "misinformation", "other"}
+
+// reportReasonFilter marks reports opened by the chirp filter rather than a
+// user.
+const reportReasonFilter = "filter"
+
+const maxReportDetailsLength = 1000
+
+// Resolutions a moderator can choose when resolving a report.
+const (
+	resolutionDismiss = "dismiss"
+	resolutionHide    = "hide"
+	resolutionDelete  = "delete"
+	resolutionWarn    = "warn"
+	resolutionSuspend = "suspend"
+)
+
+type Report struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ChirpID   *uuid.UUID `json:"chirp_id"`
+	Reason    string     `json:"reason"`
+	Details   string     `json:"details"`
+	Status    string     `json:"status"`
+}
+
+// ModerationReport is a report as moderators see it.
+type ModerationReport struct {
+	Report
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ReporterID     *uuid.UUID `json:"reporter_id"`
+	ClaimedBy      *uuid.UUID `json:"claimed_by"`
+	ClaimedAt      *time.Time `json:"claimed_at"`
+	ResolvedBy     *uuid.UUID `json:"resolved_by"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	Resolution     string     `json:"resolution,omitempty"`
+	ResolutionNote string     `json:"resolution_note,omitempty"`
+}
+
+type ModerationAction struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ModeratorID  *uuid.UUID `json:"moderator_id"`
+	Action       string     `json:"action"`
+	ReportID     *uuid.UUID `json:"report_id"`
+	ChirpID      *uuid.UUID `json:"chirp_id"`
+	TargetUserID *uuid.UUID `json:"target_user_id"`
+	Note         string     `json:"note"`
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func toReport(report database.Report) Report {
+	return Report{
+		ID:        report.ID,
+		CreatedAt: report.CreatedAt,
+		ChirpID:   nullUUIDPtr(report.ChirpID),
+		Reason:    report.Reason,
+		Details:   report.Details,
+		Status:    report.Status,
+	}
+}
+
+func toModerationReport(report database.Report) ModerationReport {
+	return ModerationReport{
+		Report:         toReport(report),
+		UpdatedAt:      report.UpdatedAt,
+		ReporterID:     nullUUIDPtr(report.ReporterID),
+		ClaimedBy:      nullUUIDPtr(report.ClaimedBy),
+		ClaimedAt:      nullTimePtr(report.ClaimedAt),
+		ResolvedBy:     nullUUIDPtr(report.ResolvedBy),
+		ResolvedAt:     nullTimePtr(report.ResolvedAt),
+		Resolution:     report.Resolution,
+		ResolutionNote: report.ResolutionNote,
+	}
+}
+
+func toModerationAction(action database.ModerationAction) ModerationAction {
+	return ModerationAction{
+		ID:           action.ID,
+		CreatedAt:    action.CreatedAt,
+		ModeratorID:  nullUUIDPtr(action.ModeratorID),
+		Action:       action.Action,
+		ReportID:     nullUUIDPtr(action.ReportID),
+		ChirpID:      nullUUIDPtr(action.ChirpID),
+		TargetUserID: nullUUIDPtr(action.TargetUserID),
+		Note:         action.Note,
+	}
+}
+
+// recordModerationAction adds to the moderation trail. Like audit, failing
+// to record never fails the request.
+func (cfg *apiConfig) recordModerationAction(ctx context.Context, params database.CreateModerationActionParams) {
+	if err := cfg.dbQueries.CreateModerationAction(ctx, params); err != nil {
+		log.Printf("Couldn't record moderation action %s: %v", params.Action, err)
+	}
+}
+
+// flagChirpForReview puts a chirp the chirp filter flagged in the
+// moderation queue.
+func (cfg *apiConfig) flagChirpForReview(ctx context.Context, chirp database.Chirp, phrases []string) {
+	if _, err := cfg.dbQueries.CreateReport(ctx, database.CreateReportParams{
+		ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		Reason:  reportReasonFilter,
+		Details: "Matched: " + strings.Join(phrases, ", "),
+	}); err != nil {
+		log.Printf("Couldn't queue flagged chirp %s: %v", chirp.ID, err)
+	}
+}
+
+func (cfg *apiConfig) handlerCreateReport(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid chirp ID", err)
+		return
+	}
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	if !slices.Contains(reportReasons, params.Reason) {
+		respondWithError(w, 400, "Reason must be one of "+strings.Join(reportReasons, ", "), nil)
+		return
+	}
+	params.Details = strings.TrimSpace(params.Details)
+	if utf8.RuneCountInString(params.Details) > maxReportDetailsLength {
+		respondWithError(w, 400, "Details must be at most "+strconv.Itoa(maxReportDetailsLength)+" characters", nil)
+		return
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	chirp, err := cfg.dbQueries.GetVisibleChirpByID(r.Context(), database.GetVisibleChirpByIDParams{
+		ID:       chirpID,
+		ViewerID: principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 404, "No chirp found", err)
+		return
+	}
+	if chirp.UserID == principal.UserID {
+		respondWithError(w, 400, "You can't report your own chirp", nil)
+		return
+	}
+
+	report, err := cfg.dbQueries.CreateReport(r.Context(), database.CreateReportParams{
+		ChirpID:    uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		ReporterID: uuid.NullUUID{UUID: principal.UserID, Valid: true},
+		Reason:     params.Reason,
+		Details:    params.Details,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "You have already reported this chirp", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Couldn't create report", err)
+		return
+	}
+	respondWithJson(w, 201, toReport(report))
+}
+
+// handlerGetReports lists the moderation queue, oldest first. ?status picks
+// open (the default), claimed or resolved reports.
+func (cfg *apiConfig) handlerGetReports(w http.ResponseWriter, r *http.Request) {
+	type QueueChirp struct {
+		Body     string    `json:"body"`
+		AuthorID uuid.UUID `json:"author_id"`
+		Hidden   bool      `json:"hidden"`
+	}
+	type QueueItem struct {
+		ModerationReport
+		Chirp *QueueChirp `json:"chirp"`
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	}
+	if status != "open" && status != "claimed" && status != "resolved" {
+		respondWithError(w, 400, "Status must be open, claimed or resolved", nil)
+		return
+	}
+	limit := 50
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+
+	rows, err := cfg.dbQueries.GetReports(r.Context(), database.GetReportsParams{
+		Status: status,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve reports", err)
+		return
+	}
+	resp := []QueueItem{}
+	for _, row := range rows {
+		item := QueueItem{ModerationReport: toModerationReport(database.Report{
+			ID:             row.ID,
+			CreatedAt:      row.CreatedAt,
+			UpdatedAt:      row.UpdatedAt,
+			ChirpID:        row.ChirpID,
+			ReporterID:     row.ReporterID,
+			Reason:         row.Reason,
+			Details:        row.Details,
+			Status:         row.Status,
+			ClaimedBy:      row.ClaimedBy,
+			ClaimedAt:      row.ClaimedAt,
+			ResolvedBy:     row.ResolvedBy,
+			ResolvedAt:     row.ResolvedAt,
+			Resolution:     row.Resolution,
+			ResolutionNote: row.ResolutionNote,
+		})}
+		if row.ChirpBody.Valid {
+			item.Chirp = &QueueChirp{
+				Body:     row.ChirpBody.String,
+				AuthorID: row.ChirpAuthorID.UUID,
+				Hidden:   row.ChirpHiddenAt.Valid,
+			}
+		}
+		resp = append(resp, item)
+	}
+	respondWithJson(w, 200, resp)
+}
+
+// handlerGetReport shows one report with every moderator action taken on it.
+func (cfg *apiConfig) handlerGetReport(w http.ResponseWriter, r *http.Request) {
+	type Response struct {
+		ModerationReport
+		Actions []ModerationAction `json:"actions"`
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid report ID", err)
+		return
+	}
+	report, err := cfg.dbQueries.GetReportByID(r.Context(), reportID)
+	if err != nil {
+		respondWithError(w, 404, "Report not found", err)
+		return
+	}
+	actions, err := cfg.dbQueries.GetModerationActionsByReportID(r.Context(), uuid.NullUUID{UUID: report.ID, Valid: true})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve moderation actions", err)
+		return
+	}
+	resp := Response{ModerationReport: toModerationReport(report), Actions: []ModerationAction{}}
+	for _, action := range actions {
+		resp.Actions = append(resp.Actions, toModerationAction(action))
+	}
+	respondWithJson(w, 200, resp)
+}
+
+// claimReport assigns an open report to the moderator so two moderators
+// don't work on it at once. Claiming a report you already hold is a no-op.
+// It writes the error response and returns false on failure.
+func (cfg *apiConfig) claimReport(w http.ResponseWriter, r *http.Request, reportID, moderatorID uuid.UUID) (database.Report, bool) {
+	report, err := cfg.dbQueries.ClaimReport(r.Context(), database.ClaimReportParams{
+		ID:        reportID,
+		ClaimedBy: uuid.NullUUID{UUID: moderatorID, Valid: true},
+	})
+	if err == nil {
+		return report, true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 500, "Couldn't claim report", err)
+		return report, false
+	}
+	report, err = cfg.dbQueries.GetReportByID(r.Context(), reportID)
+	switch {
+	case err != nil:
+		respondWithError(w, 404, "Report not found", err)
+	case report.Status == "resolved":
+		respondWithError(w, 409, "Report is already resolved", nil)
+	default:
+		respondWithError(w, 409, "Report is claimed by another moderator", nil)
+	}
+	return report, false
+}
+
+func (cfg *apiConfig) handlerClaimReport(w http.ResponseWriter, r *http.Request) {
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid report ID", err)
+		return
+	}
+	moderator, _ := actorFromContext(r.Context())
+
+	report, ok := cfg.claimReport(w, r, reportID, moderator.ID)
+	if !ok {
+		return
+	}
+	cfg.recordModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		Action:      "claim",
+		ReportID:    uuid.NullUUID{UUID: report.ID, Valid: true},
+		ChirpID:     report.ChirpID,
+	})
+	respondWithJson(w, 200, toModerationReport(report))
+}
+
+// handlerUnclaimReport puts a report the moderator claimed back in the queue.
+func (cfg *apiConfig) handlerUnclaimReport(w http.ResponseWriter, r *http.Request) {
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid report ID", err)
+		return
+	}
+	moderator, _ := actorFromContext(r.Context())
+
+	released, err := cfg.dbQueries.UnclaimReport(r.Context(), database.UnclaimReportParams{
+		ID:        reportID,
+		ClaimedBy: uuid.NullUUID{UUID: moderator.ID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't release report", err)
+		return
+	}
+	if released == 0 {
+		respondWithError(w, 409, "You haven't claimed this report", nil)
+		return
+	}
+	cfg.recordModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		Action:      "unclaim",
+		ReportID:    uuid.NullUUID{UUID: reportID, Valid: true},
+	})
+	w.WriteHeader(204)
+}
+
+// handlerResolveReport closes a report, and every other open report of the
+// same chirp, with the moderator's decision: dismiss it, hide or delete the
+// chirp, or warn or suspend its author. An open report is claimed first.
+func (cfg *apiConfig) handlerResolveReport(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Action     string `json:"action"`
+		Note       string `json:"note"`
+		SuspendFor string `json:"suspend_for"`
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid report ID", err)
+		return
+	}
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	params.Note = strings.TrimSpace(params.Note)
+	var suspendFor time.Duration
+	switch params.Action {
+	case resolutionDismiss, resolutionHide, resolutionDelete:
+	case resolutionWarn:
+		if params.Note == "" {
+			respondWithError(w, 400, "A note for the author is required to warn them", nil)
+			return
+		}
+	case resolutionSuspend:
+		if suspendFor, err = parseRestrictionDuration(params.SuspendFor); err != nil {
+			respondWithError(w, 400, "suspend_for "+err.Error(), nil)
+			return
+		}
+	default:
+		respondWithError(w, 400, "Action must be dismiss, hide, delete, warn or suspend", nil)
+		return
+	}
+	moderator, _ := actorFromContext(r.Context())
+
+	report, ok := cfg.claimReport(w, r, reportID, moderator.ID)
+	if !ok {
+		return
+	}
+
+	var chirp database.Chirp
+	var author database.User
+	if params.Action != resolutionDismiss {
+		if !report.ChirpID.Valid {
+			respondWithError(w, 409, "The chirp no longer exists, the report can only be dismissed", nil)
+			return
+		}
+		if chirp, err = cfg.dbQueries.GetChirpByID(r.Context(), report.ChirpID.UUID); err != nil {
+			respondWithError(w, 409, "The chirp no longer exists, the report can only be dismissed", err)
+			return
+		}
+		if author, err = cfg.dbQueries.GetUserByID(r.Context(), chirp.UserID); err != nil {
+			respondWithError(w, 500, "Couldn't retrieve the chirp's author", err)
+			return
+		}
+	}
+
+	switch params.Action {
+	case resolutionHide:
+		if err := cfg.dbQueries.HideChirp(r.Context(), chirp.ID); err != nil {
+			respondWithError(w, 500, "Couldn't hide chirp", err)
+			return
+		}
+		cfg.publishChirpEvent(r.Context(), chirpEventDeleted, chirp)
+	case resolutionWarn:
+		cfg.notifyAuthor(r.Context(), author, "You received a warning from Chirpy moderators",
+			fmt.Sprintf("A moderator reviewed your chirp:\n\n%s\n\nand issued a warning:\n\n%s", chirp.Body, params.Note))
+	case resolutionSuspend:
+		if author.Role != string(auth.RoleUser) {
+			respondWithError(w, 403, "Moderators and admins can't be suspended from a report", nil)
+			return
+		}
+		until := time.Now().Add(suspendFor)
+		if err := cfg.suspendUser(r.Context(), author, until, params.Note); err != nil {
+			respondWithError(w, 500, "Couldn't suspend user", err)
+			return
+		}
+		cfg.notifyAuthor(r.Context(), author, "Your Chirpy account has been suspended",
+			fmt.Sprintf("A moderator suspended your account until %s because of this chirp:\n\n%s\n\n%s",
+				until.UTC().Format(time.RFC1123), chirp.Body, params.Note))
+	}
+
+	// Resolve before deleting, since deleting the chirp unlinks its reports.
+	if _, err := cfg.dbQueries.ResolveReports(r.Context(), database.ResolveReportsParams{
+		ID:             report.ID,
+		ChirpID:        report.ChirpID,
+		ResolvedBy:     uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		Resolution:     params.Action,
+		ResolutionNote: params.Note,
+	}); err != nil {
+		respondWithError(w, 500, "Couldn't resolve report", err)
+		return
+	}
+	if params.Action == resolutionDelete {
+		if err := cfg.dbQueries.DeleteChirp(r.Context(), chirp.ID); err != nil {
+			respondWithError(w, 500, "Couldn't delete chirp", err)
+			return
+		}
+		cfg.publishChirpEvent(r.Context(), chirpEventDeleted, chirp)
+	}
+
+	action := database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		Action:      params.Action,
+		ReportID:    uuid.NullUUID{UUID: report.ID, Valid: true},
+		ChirpID:     report.ChirpID,
+		Note:        params.Note,
+	}
+	if params.Action != resolutionDismiss {
+		action.TargetUserID = uuid.NullUUID{UUID: author.ID, Valid: true}
+	}
+	if params.Action == resolutionSuspend {
+		action.Note = strings.TrimSpace(params.SuspendFor + " " + params.Note)
+	}
+	cfg.recordModerationAction(r.Context(), action)
+
+	resolved, err := cfg.dbQueries.GetReportByID(r.Context(), report.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve report", err)
+		return
+	}
+	respondWithJson(w, 200, toModerationReport(resolved))
+}
+
+// notifyAuthor emails the author of a chirp about a moderation decision.
+func (cfg *apiConfig) notifyAuthor(ctx context.Context, author database.User, subject, body string) {
+	if err := cfg.Mailer.Send(ctx, mailer.Message{To: author.Email, Subject: subject, Body: body}); err != nil {
+		log.Printf("Couldn't notify %s of moderation decision: %v", author.Email, err)
+	}
+}
+
+// handlerGetModerationActions lists the most recent moderator actions.
+func (cfg *apiConfig) handlerGetModerationActions(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 1000 {
+		limit = n
+	}
+	actions, err := cfg.dbQueries.GetModerationActions(r.Context(), int32(limit))
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve moderation actions", err)
+		return
+	}
+	resp := []ModerationAction{}
+	for _, action := range actions {
+		resp = append(resp, toModerationAction(action))
+	}
+	respondWithJson(w, 200, resp)
+}
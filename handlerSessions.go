@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UserAgent  string     `json:"user_agent"`
+	IpAddress  string     `json:"ip_address"`
+}
+
+// clientIP returns the remote address of the request without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (cfg *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	userID := principal.UserID
+
+	tokens, err := cfg.dbQueries.GetActiveRefreshTokensByUserID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve sessions", err)
+		return
+	}
+
+	sessions := []Session{}
+	for _, tok := range tokens {
+		session := Session{
+			ID:        tok.ID,
+			CreatedAt: tok.CreatedAt,
+			ExpiresAt: tok.ExpiresAt,
+			UserAgent: tok.UserAgent,
+			IpAddress: tok.IpAddress,
+		}
+		if tok.LastUsedAt.Valid {
+			session.LastUsedAt = &tok.LastUsedAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+	respondWithJson(w, 200, sessions)
+}
+
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid session ID", err)
+		return
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	userID := principal.UserID
+
+	revoked, err := cfg.dbQueries.RevokeRefreshTokenByID(r.Context(), database.RevokeRefreshTokenByIDParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't revoke session", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "No active session found", nil)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	userID := principal.UserID
+
+	if err := cfg.dbQueries.RevokeAllRefreshTokensForUser(r.Context(), userID); err != nil {
+		respondWithError(w, 500, "Couldn't revoke sessions", err)
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+const recoveryCodeCount = 10
+
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	type Response struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	if user.TotpEnabled {
+		respondWithError(w, 409, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, 500, "Couldn't make TOTP secret", err)
+		return
+	}
+	if err := cfg.dbQueries.SetTOTPSecret(r.Context(), database.SetTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	}); err != nil {
+		respondWithError(w, 500, "Couldn't save TOTP secret", err)
+		return
+	}
+
+	respondWithJson(w, 200, Response{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(secret, user.Email),
+	})
+}
+
+// handlerConfirmTOTP turns 2FA on once the user proves their authenticator
+// produces valid codes, and hands out the recovery codes.
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Code string `json:"code"`
+	}
+	type Response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	if user.TotpEnabled {
+		respondWithError(w, 409, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, 400, "Start enrollment first", nil)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, 401, "Invalid code", nil)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't make recovery codes", err)
+		return
+	}
+	if err := cfg.dbQueries.DeleteRecoveryCodes(r.Context(), user.ID); err != nil {
+		respondWithError(w, 500, "Couldn't clear recovery codes", err)
+		return
+	}
+	for _, code := range codes {
+		hashed, err := auth.HashPassword(code)
+		if err != nil {
+			respondWithError(w, 500, "Internal Hashing error", err)
+			return
+		}
+		if err := cfg.dbQueries.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: hashed,
+		}); err != nil {
+			respondWithError(w, 500, "Couldn't save recovery codes", err)
+			return
+		}
+	}
+	if err := cfg.dbQueries.EnableTOTP(r.Context(), database.EnableTOTPParams{
+		ID:               user.ID,
+		TotpLastUsedStep: step,
+	}); err != nil {
+		respondWithError(w, 500, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	respondWithJson(w, 200, Response{RecoveryCodes: codes})
+}
+
+// handlerDisableTOTP turns 2FA off. It takes the password plus a current
+// code, or a recovery code if the authenticator is lost, and only from a
+// login session: personal access tokens and OAuth clients can't do it.
+func (cfg *apiConfig) handlerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	if principal.Method != auth.AuthMethodJWT {
+		respondWithError(w, 403, "Two-factor authentication can only be disabled from a login session", nil)
+		return
+	}
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	if !user.TotpEnabled {
+		respondWithError(w, 400, "Two-factor authentication is not enabled", nil)
+		return
+	}
+	code := params.Code
+	if code == "" {
+		code = params.RecoveryCode
+	}
+	if !cfg.reauthenticate(w, r, user, params.Password, code) {
+		return
+	}
+
+	if err := cfg.dbQueries.DisableTOTP(r.Context(), user.ID); err != nil {
+		respondWithError(w, 500, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	if err := cfg.dbQueries.DeleteRecoveryCodes(r.Context(), user.ID); err != nil {
+		respondWithError(w, 500, "Couldn't clear recovery codes", err)
+		return
+	}
+	cfg.audit(r.Context(), "totp.disabled", uuid.NullUUID{UUID: user.ID, Valid: true}, user.ID.String(), "")
+	w.WriteHeader(204)
+}
+
+// handlerLoginTOTP is the second login step. It takes the challenge token
+// from handlerValidateLogin plus either a TOTP code or a recovery code.
+func (cfg *apiConfig) handlerLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+
+	claims, err := cfg.JwtKeys.ParseJWT(params.ChallengeToken, auth.MFAChallengeAudience)
+	if err != nil {
+		respondWithError(w, 401, "Challenge token invalid or expired", err)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, 401, "Challenge token invalid or expired", err)
+		return
+	}
+	if !user.TotpEnabled || !user.TotpSecret.Valid {
+		respondWithError(w, 400, "Two-factor authentication is not enabled", nil)
+		return
+	}
+	account, ip := loginAccount(user.Email), clientIP(r)
+	if !cfg.checkLoginAllowed(w, account, ip) {
+		return
+	}
+
+	switch {
+	case params.Code != "":
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now())
+		if !ok {
+			cfg.LoginGuard.RecordFailure(account, ip)
+			respondWithError(w, 401, "Invalid code", nil)
+			return
+		}
+		// Each step can only be used once, so a code seen over someone's
+		// shoulder can't be replayed.
+		used, err := cfg.dbQueries.UseTOTPStep(r.Context(), database.UseTOTPStepParams{
+			ID:               user.ID,
+			TotpLastUsedStep: step,
+		})
+		if err != nil {
+			respondWithError(w, 500, "Couldn't record code", err)
+			return
+		}
+		if used == 0 {
+			respondWithError(w, 401, "Code already used", nil)
+			return
+		}
+	case params.RecoveryCode != "":
+		if !cfg.useRecoveryCode(r, user, params.RecoveryCode) {
+			cfg.LoginGuard.RecordFailure(account, ip)
+			respondWithError(w, 401, "Invalid recovery code", nil)
+			return
+		}
+	default:
+		respondWithError(w, 400, "A code or recovery code is required", nil)
+		return
+	}
+
+	if !checkNotSuspended(w, user) {
+		return
+	}
+	cfg.LoginGuard.RecordSuccess(account, ip)
+	cfg.respondWithSession(w, r, user)
+}
+
+// checkTOTPCode validates a code against the user's secret and records its
+// step, so the same code can't be used twice.
+func (cfg *apiConfig) checkTOTPCode(ctx context.Context, user database.User, code string) bool {
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+	if !ok {
+		return false
+	}
+	used, err := cfg.dbQueries.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		ID:               user.ID,
+		TotpLastUsedStep: step,
+	})
+	return err == nil && used == 1
+}
+
+// checkSecondFactor accepts either a TOTP code or, told apart by its dash,
+// an unused recovery code, which is then used up.
+func (cfg *apiConfig) checkSecondFactor(r *http.Request, user database.User, code string) bool {
+	if strings.Contains(code, "-") {
+		return cfg.useRecoveryCode(r, user, code)
+	}
+	return cfg.checkTOTPCode(r.Context(), user, code)
+}
+
+func (cfg *apiConfig) useRecoveryCode(r *http.Request, user database.User, code string) bool {
+	codes, err := cfg.dbQueries.GetUnusedRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		return false
+	}
+	for _, stored := range codes {
+		if auth.CheckPasswordHash(stored.CodeHash, code) != nil {
+			continue
+		}
+		used, err := cfg.dbQueries.UseRecoveryCode(r.Context(), stored.ID)
+		return err == nil && used == 1
+	}
+	return false
+}
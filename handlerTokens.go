@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func toPersonalAccessToken(pat database.PersonalAccessToken) PersonalAccessToken {
+	resp := PersonalAccessToken{
+		ID:        pat.ID,
+		Name:      pat.Name,
+		Scopes:    pat.Scopes,
+		CreatedAt: pat.CreatedAt,
+	}
+	if pat.LastUsedAt.Valid {
+		resp.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	if pat.ExpiresAt.Valid {
+		resp.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	return resp
+}
+
+func (cfg *apiConfig) handlerCreateToken(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, 400, "Token name is required", nil)
+		return
+	}
+	if len(params.Scopes) == 0 {
+		respondWithError(w, 400, "At least one scope is required", nil)
+		return
+	}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(auth.PersonalAccessTokenScopes, scope) {
+			respondWithError(w, 400, "Scope not allowed for personal access tokens: "+scope, nil)
+			return
+		}
+	}
+	if params.ExpiresInDays < 0 {
+		respondWithError(w, 400, "expires_in_days can't be negative", nil)
+		return
+	}
+
+	expiresAt := sql.NullTime{}
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{
+			Time:  time.Now().AddDate(0, 0, params.ExpiresInDays),
+			Valid: true,
+		}
+	}
+
+	plainToken, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(w, 500, "Couldn't make token", err)
+		return
+	}
+	pat, err := cfg.dbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    principal.UserID,
+		Name:      params.Name,
+		TokenHash: auth.HashToken(plainToken),
+		Scopes:    params.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't save token", err)
+		return
+	}
+
+	// The plaintext token is only ever shown in this response.
+	resp := toPersonalAccessToken(pat)
+	resp.Token = plainToken
+	respondWithJson(w, 201, resp)
+}
+
+func (cfg *apiConfig) handlerGetTokens(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	pats, err := cfg.dbQueries.GetPersonalAccessTokensByUserID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't retrieve tokens", err)
+		return
+	}
+
+	resp := []PersonalAccessToken{}
+	for _, pat := range pats {
+		resp = append(resp, toPersonalAccessToken(pat))
+	}
+	respondWithJson(w, 200, resp)
+}
+
+func (cfg *apiConfig) handlerRevokeToken(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid token ID", err)
+		return
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	revoked, err := cfg.dbQueries.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Couldn't revoke token", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "No active token found", nil)
+		return
+	}
+	w.WriteHeader(204)
+}
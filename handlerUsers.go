@@ -3,9 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
+	"net/mail"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,42 +20,64 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 	}
 
 	type Response struct {
-		Id         uuid.UUID `json:"id"`
-		Created_at time.Time `json:"created_at"`
-		Updated_at time.Time `json:"updated_at"`
-		Email      string    `json:"email"`
-		Password   string    `json:"password"`
-		Sub        bool      `json:"is_chirpy_red"`
+		Id            uuid.UUID `json:"id"`
+		Created_at    time.Time `json:"created_at"`
+		Updated_at    time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		Password      string    `json:"password"`
+		Sub           bool      `json:"is_chirpy_red"`
+		EmailVerified bool      `json:"email_verified"`
 	}
 	params := Params{}
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Could not decode params", err)
+		return
 	}
-	hashedPassword, err := auth.HashPassword(params.Password)
+	if !validEmail(params.Email) {
+		respondWithError(w, 400, "Invalid email address", nil)
+		return
+	}
+	if err := cfg.PasswordPolicy.Validate(params.Password); err != nil {
+		respondWithError(w, 400, err.Error(), nil)
+		return
+	}
+	hashedPassword, err := cfg.Passwords.Hash(params.Password)
 	if err != nil {
 		respondWithError(w, 500, "Internal Hashing error", err)
+		return
 	}
 
 	userEmail := params.Email
-	user, error := cfg.dbQueries.CreateUser(context.Background(), database.CreateUserParams{
+	user, err := cfg.dbQueries.CreateUser(context.Background(), database.CreateUserParams{
 		Email:          userEmail,
 		HashedPassword: hashedPassword})
 
 	if err != nil {
-		log.Fatal("user not created %s", error)
+		respondWithError(w, 500, "User not created", err)
+		return
+	}
+	// The account exists either way; the user can ask for a new link later.
+	if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+		log.Printf("Couldn't send verification email to %s: %v", user.Email, err)
 	}
 	respondWithJson(w, 201, Response{
-		Id:         user.ID,
-		Created_at: user.CreatedAt,
-		Updated_at: user.UpdatedAt,
-		Email:      user.Email,
-		Password:   params.Password,
-		Sub:        user.IsChirpyRed,
+		Id:            user.ID,
+		Created_at:    user.CreatedAt,
+		Updated_at:    user.UpdatedAt,
+		Email:         user.Email,
+		Password:      params.Password,
+		Sub:           user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	})
 }
 
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
 func (cfg *apiConfig) handlerValidateLogin(w http.ResponseWriter, r *http.Request) {
 	type Params struct {
 		Email    string `json:"email"`
@@ -67,32 +89,112 @@ func (cfg *apiConfig) handlerValidateLogin(w http.ResponseWriter, r *http.Reques
 	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, 500, "Internal json reading error", err)
+		return
+	}
+	account, ip := loginAccount(params.Email), clientIP(r)
+	if !cfg.checkLoginAllowed(w, account, ip) {
+		return
 	}
 	user, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
 	if err != nil {
+		cfg.LoginGuard.RecordFailure(account, ip)
 		respondWithError(w, http.StatusBadRequest, "No user exists, please check email or password", err)
+		return
 	}
 
-	if err := auth.CheckPasswordHash(user.HashedPassword, params.Password); err != nil {
+	if err := cfg.Passwords.Verify(user.HashedPassword, params.Password); err != nil {
+		cfg.LoginGuard.RecordFailure(account, ip)
 		respondWithError(w, 401, "Password or email is incorrect", err)
+		return
+	}
+	cfg.rehashIfNeeded(r.Context(), user, params.Password)
+	cfg.completeLogin(w, r, user)
+}
+
+// completeLogin finishes a login once the first factor has been checked.
+// Users with 2FA get a short-lived challenge instead of a session, which is
+// exchanged at /api/login/totp. Failed logins are only forgiven once the
+// user is fully authenticated, so knowing the password doesn't reset the
+// count of wrong codes.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	if !checkNotSuspended(w, user) {
+		return
+	}
+	if user.TotpEnabled {
+		challenge, err := cfg.JwtKeys.MakeScopedJWT(user.ID, auth.MFAChallengeAudience, nil, 5*time.Minute)
+		if err != nil {
+			respondWithError(w, 500, "Couldn't make challenge token", err)
+			return
+		}
+		type Response struct {
+			MfaRequired    bool   `json:"mfa_required"`
+			ChallengeToken string `json:"challenge_token"`
+		}
+		respondWithJson(w, 200, Response{MfaRequired: true, ChallengeToken: challenge})
+		return
 	}
 
-	// Refresh Token
+	cfg.LoginGuard.RecordSuccess(loginAccount(user.Email), clientIP(r))
+	cfg.respondWithSession(w, r, user)
+}
+
+// rehashIfNeeded upgrades a stored hash made with an old algorithm or weaker
+// parameters while the plaintext password is at hand. Failure only delays
+// the upgrade to the next login.
+func (cfg *apiConfig) rehashIfNeeded(ctx context.Context, user database.User, password string) {
+	if !cfg.Passwords.NeedsRehash(user.HashedPassword) {
+		return
+	}
+	hashed, err := cfg.Passwords.Hash(password)
+	if err != nil {
+		log.Printf("Couldn't rehash password for %s: %v", user.ID, err)
+		return
+	}
+	if err := cfg.dbQueries.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             user.ID,
+		HashedPassword: hashed,
+	}); err != nil {
+		log.Printf("Couldn't store rehashed password for %s: %v", user.ID, err)
+	}
+}
+
+// SessionTokens are the access token and refresh token of a new session.
+type SessionTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// createSession creates a refresh token and access token for a user that
+// has fully authenticated.
+func (cfg *apiConfig) createSession(r *http.Request, user database.User) (SessionTokens, error) {
 	refreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		respondWithError(w, 500, "Couldn't make refresh token", err)
+		return SessionTokens{}, err
 	}
 	_, err = cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  refreshToken,
-		UserID: user.ID})
+		TokenHash: auth.HashToken(refreshToken),
+		UserID:    user.ID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r)})
 	if err != nil {
-		respondWithError(w, 500, "Couldn't create and retrive token", err)
+		return SessionTokens{}, err
 	}
+	token, err := cfg.JwtKeys.MakeJWT(user.ID, time.Duration(time.Hour))
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	return SessionTokens{Token: token, RefreshToken: refreshToken}, nil
+}
 
-	//JWT
-	token, err := auth.MakeJWT(user.ID, cfg.JwtSecret, time.Duration(time.Hour))
+// respondWithSession starts a session for a user that has fully
+// authenticated and writes the login response.
+func (cfg *apiConfig) respondWithSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	cfg.cancelAccountDeletion(r.Context(), user)
+
+	session, err := cfg.createSession(r, user)
 	if err != nil {
-		respondWithError(w, 500, "Couldn't make JWT", err)
+		respondWithError(w, 500, "Couldn't create session", err)
+		return
 	}
 
 	type Response struct {
@@ -111,53 +213,99 @@ func (cfg *apiConfig) handlerValidateLogin(w http.ResponseWriter, r *http.Reques
 		Created_at:   user.CreatedAt,
 		Updated_at:   user.UpdatedAt,
 		Email:        user.Email,
-		Token:        token,
-		RefreshToken: refreshToken,
+		Token:        session.Token,
+		RefreshToken: session.RefreshToken,
 		Sub:          user.IsChirpyRed,
 	})
 }
+
 func (cfg *apiConfig) handlerResetUsers(w http.ResponseWriter, r *http.Request) {
 	if cfg.Platform != "dev" {
 		respondWithJson(w, 403, "Forbidden")
+		return
 	}
 	if err := cfg.dbQueries.DeleteUsers(context.Background()); err != nil {
-		log.Fatal("error deleting users %v")
+		respondWithError(w, 500, "Error deleting users", err)
+		return
 	}
 
 	respondWithJson(w, 200, "Deleted users")
 }
 
+// handlerUpdateUser changes the caller's password and/or email after they
+// re-enter their current password. A new email only takes effect once it is
+// confirmed from the new inbox, so the response lists it as pending. A new
+// password signs out every other session and the response carries a fresh
+// one for the caller.
 func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
 	type Params struct {
-		Token    string `json:"token"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
 	}
-	authToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, 401, "No Auth header", err)
+	type Response struct {
+		Email        string         `json:"email"`
+		PendingEmail string         `json:"pending_email,omitempty"`
+		Session      *SessionTokens `json:"session,omitempty"`
 	}
+	principal, _ := auth.PrincipalFromContext(r.Context())
 
 	var params Params
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&params); err != nil {
-		respondWithError(w, 401, "Missing data", err)
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
 	}
-	fmt.Printf("Users email: %v, User password: %v", params.Email, params.Password)
-	userID, err := auth.ValidateJWT(authToken, cfg.JwtSecret)
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
 	if err != nil {
-		respondWithError(w, 401, "Recieved Token but couldn't validate it", err)
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	changeEmail := params.Email != "" && params.Email != user.Email
+	if params.Password == "" && !changeEmail {
+		respondWithJson(w, 200, Response{Email: user.Email})
+		return
+	}
+	if !cfg.reauthenticate(w, r, user, params.CurrentPassword, params.Code) {
+		return
 	}
 
-	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	// Check everything before changing anything, so a bad email doesn't
+	// leave the password changed behind the caller's back.
+	if params.Password != "" {
+		if err := cfg.PasswordPolicy.Validate(params.Password); err != nil {
+			respondWithError(w, 400, err.Error(), nil)
+			return
+		}
+	}
+	if changeEmail {
+		if err := cfg.checkNewEmail(r.Context(), user, params.Email); err != nil {
+			emailChangeError(w, err)
+			return
+		}
+	}
 
-	password, _ := auth.HashPassword(params.Password)
-	cfg.dbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             user.ID,
-		Email:          params.Email,
-		HashedPassword: password})
-	type Response struct {
-		Email string `json:"email"`
+	// The email goes first: if the confirmation can't be sent, nothing has
+	// changed yet.
+	response := Response{Email: user.Email}
+	if changeEmail {
+		if err := cfg.requestEmailChange(r.Context(), cfg.dbQueries, user, params.Email); err != nil {
+			emailChangeError(w, err)
+			return
+		}
+		response.PendingEmail = params.Email
+	}
+	if params.Password != "" {
+		if err := cfg.changePassword(r.Context(), user, params.Password); err != nil {
+			respondWithError(w, 500, "Couldn't change password", err)
+			return
+		}
+		session, err := cfg.createSession(r, user)
+		if err != nil {
+			respondWithError(w, 500, "Couldn't create session", err)
+			return
+		}
+		response.Session = &session
 	}
-	respondWithJson(w, 200, Response{Email: params.Email})
+	respondWithJson(w, 200, response)
 }
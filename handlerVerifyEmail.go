@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/mailer"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// sendVerificationEmail mails a single-use token proving the user controls
+// email. The address is stored with the token so a token for an old address
+// can't verify a new one.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	verification, err := cfg.dbQueries.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+		UserID: userID,
+		Email:  email,
+	})
+	if err != nil {
+		return err
+	}
+	token, err := cfg.JwtKeys.MakeSingleUseJWT(userID, auth.EmailVerifyAudience, verification.ID, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Confirm this address by sending this token to POST /api/users/verify:\n%s\n\n"+
+			"The token expires in 24 hours.", token),
+	})
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type Params struct {
+		Token string `json:"token"`
+	}
+	type Response struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+
+	var params Params
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return
+	}
+
+	claims, err := cfg.JwtKeys.ParseJWT(params.Token, auth.EmailVerifyAudience)
+	if err != nil {
+		respondWithError(w, 400, "Verification token invalid or expired", err)
+		return
+	}
+	verificationID, err := uuid.Parse(claims.TokenID)
+	if err != nil {
+		respondWithError(w, 400, "Verification token invalid or expired", err)
+		return
+	}
+	verification, err := cfg.dbQueries.GetEmailVerification(r.Context(), verificationID)
+	if err != nil || verification.UserID != claims.UserID {
+		respondWithError(w, 400, "Verification token invalid or expired", err)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, 400, "Verification token invalid or expired", err)
+		return
+	}
+	if user.Email != verification.Email {
+		respondWithError(w, 400, "Verification token is for a different address", nil)
+		return
+	}
+
+	used, err := cfg.dbQueries.UseEmailVerification(r.Context(), verification.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't use verification token", err)
+		return
+	}
+	if used == 0 {
+		respondWithError(w, 400, "Verification token already used", nil)
+		return
+	}
+	if err := cfg.dbQueries.MarkEmailVerified(r.Context(), user.ID); err != nil {
+		respondWithError(w, 500, "Couldn't verify email", err)
+		return
+	}
+	cfg.bootstrapAdmin(r.Context())
+
+	respondWithJson(w, 200, Response{Email: user.Email, EmailVerified: true})
+}
+
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, 409, "Email already verified", nil)
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+		respondWithError(w, 500, "Couldn't send verification email", err)
+		return
+	}
+	w.WriteHeader(202)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/websocket"
+)
+
+const (
+	wsTopicTimeline      = "timeline"
+	wsTopicNotifications = "notifications"
+
+	// wsSendBuffer is how many messages may queue up for a client before it
+	// counts as too slow and is disconnected.
+	wsSendBuffer   = 64
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	// wsSuspensionCheck is how often an open connection checks that its
+	// user hasn't been suspended since connecting.
+	wsSuspensionCheck = time.Minute
+	// wsExpiryWarning is how long before its token expires a client is told
+	// to send a fresh one.
+	wsExpiryWarning = time.Minute
+
+	// wsCloseTokenExpired closes a connection whose token ran out.
+	wsCloseTokenExpired = 4001
+	// wsCloseSuspended closes a connection whose user was suspended.
+	wsCloseSuspended = 4003
+)
+
+// wsClientMessage is anything a client sends: subscribe or unsubscribe
+// with a topic, or auth with a fresh access token.
+type wsClientMessage struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+	Token string `json:"token"`
+}
+
+type wsServerMessage struct {
+	Type      string     `json:"type"`
+	Topic     string     `json:"topic,omitempty"`
+	Event     string     `json:"event,omitempty"`
+	ID        int64      `json:"id,omitempty"`
+	Data      any        `json:"data,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// wsClient is one open /ws connection. The handler goroutine reads client
+// messages; writeLoop owns all writes to the socket.
+type wsClient struct {
+	ctx    context.Context
+	cfg    *apiConfig
+	conn   *websocket.Conn
+	userID uuid.UUID
+	send   chan wsServerMessage
+	// expiry carries the expiry of a fresh token to writeLoop.
+	expiry chan time.Time
+	done   chan struct{}
+
+	mu           sync.Mutex
+	unsubscribes map[string]func()
+}
+
+// queue hands a message to writeLoop. A client that doesn't keep up is
+// disconnected rather than buffered without bound.
+func (c *wsClient) queue(msg wsServerMessage) {
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	default:
+		c.conn.Close(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+func (c *wsClient) writeLoop(expiresAt time.Time) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	suspensionCheck := time.NewTicker(wsSuspensionCheck)
+	defer suspensionCheck.Stop()
+	// A nil channel never fires, for credentials that don't expire.
+	var warn, expire <-chan time.Time
+	setExpiry := func(t time.Time) {
+		expiresAt = t
+		warn, expire = nil, nil
+		if !t.IsZero() {
+			warn = time.After(time.Until(t.Add(-wsExpiryWarning)))
+			expire = time.After(time.Until(t))
+		}
+	}
+	setExpiry(expiresAt)
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				log.Printf("Couldn't encode WebSocket message: %v", err)
+				continue
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data, time.Now().Add(wsWriteTimeout)); err != nil {
+				c.conn.Close(websocket.CloseTryAgainLater, "client too slow")
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.Ping(time.Now().Add(wsWriteTimeout)); err != nil {
+				c.conn.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-suspensionCheck.C:
+			if c.suspended() {
+				c.conn.Close(wsCloseSuspended, "account suspended")
+				return
+			}
+		case t := <-c.expiry:
+			setExpiry(t)
+		case <-warn:
+			warn = nil
+			t := expiresAt
+			c.queue(wsServerMessage{Type: "token_expiring", ExpiresAt: &t})
+		case <-expire:
+			c.conn.Close(wsCloseTokenExpired, "token expired")
+			return
+		}
+	}
+}
+
+// subscribeTimeline forwards new chirps from everyone the user hasn't
+// blocked or muted.
+func (c *wsClient) subscribeTimeline() error {
+	timeline, err := c.cfg.timelineFilter(c.ctx, c.userID)
+	if err != nil {
+		return err
+	}
+	events, unsubscribe := c.cfg.chirpEvents.Subscribe()
+	go func() {
+		for event := range events {
+			if timeline.matches(event) {
+				c.queue(wsServerMessage{
+					Type:  "event",
+					Topic: wsTopicTimeline,
+					Event: event.Type,
+					ID:    event.ID,
+					Data:  chirpEventData(event),
+				})
+			}
+		}
+		c.dropped(wsTopicTimeline)
+	}()
+	c.unsubscribes[wsTopicTimeline] = unsubscribe
+	return nil
+}
+
+// subscribeNotifications forwards the user's new and updated notifications.
+func (c *wsClient) subscribeNotifications() {
+	notifications, unsubscribe := c.cfg.notificationEvents.Subscribe()
+	go func() {
+		for n := range notifications {
+			if n.UserID == c.userID {
+				c.queue(wsServerMessage{
+					Type:  "event",
+					Topic: wsTopicNotifications,
+					Event: "notification",
+					Data:  toNotification(n),
+				})
+			}
+		}
+		c.dropped(wsTopicNotifications)
+	}()
+	c.unsubscribes[wsTopicNotifications] = unsubscribe
+}
+
+// dropped runs once a topic's events stop. The broker dropped us for
+// falling behind, unless we unsubscribed.
+func (c *wsClient) dropped(topic string) {
+	c.mu.Lock()
+	_, subscribed := c.unsubscribes[topic]
+	c.mu.Unlock()
+	if subscribed {
+		c.conn.Close(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+func (c *wsClient) subscribe(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.unsubscribes[topic]; ok {
+		c.queue(wsServerMessage{Type: "subscribed", Topic: topic})
+		return
+	}
+	var err error
+	switch topic {
+	case wsTopicTimeline:
+		err = c.subscribeTimeline()
+	case wsTopicNotifications:
+		c.subscribeNotifications()
+	default:
+		c.queue(wsServerMessage{Type: "error", Topic: topic, Error: "Unknown topic"})
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't subscribe to %s: %v", topic, err)
+		c.queue(wsServerMessage{Type: "error", Topic: topic, Error: "Couldn't subscribe"})
+		return
+	}
+	c.queue(wsServerMessage{Type: "subscribed", Topic: topic})
+}
+
+func (c *wsClient) unsubscribe(topic string) {
+	c.mu.Lock()
+	unsubscribe, ok := c.unsubscribes[topic]
+	delete(c.unsubscribes, topic)
+	c.mu.Unlock()
+	if ok {
+		unsubscribe()
+	}
+	c.queue(wsServerMessage{Type: "unsubscribed", Topic: topic})
+}
+
+func (c *wsClient) unsubscribeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, unsubscribe := range c.unsubscribes {
+		delete(c.unsubscribes, topic)
+		unsubscribe()
+	}
+}
+
+// suspended reports whether the user has been suspended since connecting.
+// A failed lookup doesn't count; the next check tries again.
+func (c *wsClient) suspended() bool {
+	user, err := c.cfg.dbQueries.GetUserByID(c.ctx, c.userID)
+	return err == nil && isSuspended(user, time.Now())
+}
+
+// reauthenticate takes a fresh access token for the same user so the
+// connection outlives the token it was opened with. A user suspended since
+// connecting is disconnected, as writeLoop also checks every
+// wsSuspensionCheck.
+func (c *wsClient) reauthenticate(token string) {
+	principal, err := c.cfg.authenticateBearer(c.ctx, token)
+	if err != nil || principal.UserID != c.userID || !principal.HasScope(auth.ScopeChirpsRead) {
+		c.queue(wsServerMessage{Type: "error", Error: "Invalid token"})
+		return
+	}
+	if c.suspended() {
+		c.conn.Close(wsCloseSuspended, "account suspended")
+		return
+	}
+	// Only this goroutine sends on expiry, so after draining a value
+	// writeLoop hasn't picked up yet the send can't block.
+	select {
+	case <-c.expiry:
+	default:
+	}
+	c.expiry <- principal.ExpiresAt
+	c.queue(wsServerMessage{Type: "authenticated"})
+}
+
+// wsTokenFromQuery lets browsers, which can't set headers on a WebSocket,
+// pass the access token as ?access_token= instead. URLs end up in proxy and
+// access logs, so only short-lived access tokens are accepted this way, not
+// personal access tokens.
+func wsTokenFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			if auth.IsPersonalAccessToken(token) {
+				respondWithError(w, 401, "Personal access tokens must be sent in the Authorization header", nil)
+				return
+			}
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlerWebSocket serves realtime updates over a WebSocket. Clients send
+// {"type":"subscribe","topic":"timeline"}, or the "notifications" topic, to
+// start receiving events and {"type":"auth","token":...} with a fresh
+// access token before the current one expires; otherwise the connection is
+// closed with code 4001. It is closed with 4003 within a minute of the user
+// being suspended.
+func (cfg *apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 401, "User not found", err)
+		return
+	}
+	if !checkNotSuspended(w, user) {
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	conn.SetIdleTimeout(2 * wsPingInterval)
+
+	client := &wsClient{
+		ctx:          r.Context(),
+		cfg:          cfg,
+		conn:         conn,
+		userID:       user.ID,
+		send:         make(chan wsServerMessage, wsSendBuffer),
+		expiry:       make(chan time.Time, 1),
+		done:         make(chan struct{}),
+		unsubscribes: map[string]func(){},
+	}
+	go client.writeLoop(principal.ExpiresAt)
+	defer func() {
+		close(client.done)
+		client.unsubscribeAll()
+		conn.Close(websocket.CloseNormal, "")
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				log.Printf("WebSocket read failed: %v", err)
+			}
+			return
+		}
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			client.queue(wsServerMessage{Type: "error", Error: "Couldn't decode message"})
+			continue
+		}
+		switch msg.Type {
+		case "subscribe":
+			client.subscribe(msg.Topic)
+		case "unsubscribe":
+			client.unsubscribe(msg.Topic)
+		case "auth":
+			client.reauthenticate(msg.Token)
+		default:
+			client.queue(wsServerMessage{Type: "error", Error: "Unknown message type"})
+		}
+	}
+}
@@ -6,38 +6,44 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
-	"github.com/hconn7/Chirpy/internal/auth"
 )
 
+// subscriptionChirpyRed is the details of the subscription notification
+// sent when a user is upgraded to Chirpy Red.
+const subscriptionChirpyRed = "chirpy_red"
+
 func (cfg *apiConfig) handlerWebhooks(w http.ResponseWriter, r *http.Request) {
 
 	type Data struct {
 		UserID uuid.UUID `json:"user_id"`
 	}
+	// ID is the delivery's event id, the same on every retry of it.
 	type Params struct {
+		ID    string `json:"id"`
 		Event string `json:"event"`
 		Data  Data   `json:"data"`
 	}
-	header, err := auth.GetAPIKey(r.Header)
-	if err != nil {
-		respondWithError(w, 401, "Header not included", err)
-	}
-	if header != cfg.ApiKey {
-		respondWithError(w, 401, "Wrong api key!", errors.New(""))
-	}
-
 	var params Params
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&params); err != nil {
 		respondWithError(w, 401, "Couldn't decode params", err)
+		return
 	}
 
 	if params.Event != "user.upgraded" {
 		respondWithError(w, 204, "Wrong event", errors.New("Wrong event"))
+		return
 	}
 
 	if err := cfg.dbQueries.UpdateChirpyRed(r.Context(), params.Data.UserID); err != nil {
 		respondWithError(w, 404, "No user found with ID", err)
+		return
 	}
+	cfg.notify(r.Context(), notificationEvent{
+		UserID:  params.Data.UserID,
+		Type:    notificationSubscription,
+		Details: subscriptionChirpyRed,
+		EventID: params.ID,
+	})
 	respondWithJson(w, 204, "")
 }
@@ -0,0 +1,40 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteZip(t *testing.T) {
+	type profile struct {
+		Email string `json:"email"`
+	}
+	exportedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	err := WriteZip(&buf, []File{
+		{Name: "profile.json", Data: profile{Email: "saul@bettercall.com"}},
+		{Name: "chirps.json", Data: []string{"first", "second"}},
+	}, exportedAt)
+	assert.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	assert.Len(t, zr.File, 2)
+	assert.Equal(t, "profile.json", zr.File[0].Name)
+	assert.True(t, zr.File[0].Modified.Equal(exportedAt))
+
+	rc, err := zr.File[1].Open()
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	var chirps []string
+	assert.NoError(t, json.Unmarshal(data, &chirps))
+	assert.Equal(t, []string{"first", "second"}, chirps)
+}
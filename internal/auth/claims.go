@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	TokenIssuer     = "chirpy"
+	DefaultAudience = "chirpy-api"
+	// MFAChallengeAudience marks tokens that only prove a correct password
+	// and must be exchanged along with a second factor.
+	MFAChallengeAudience = "chirpy-mfa"
+	// EmailVerifyAudience marks single-use tokens mailed to prove ownership
+	// of an address.
+	EmailVerifyAudience = "chirpy-email-verify"
+	// EmailChangeAudience marks single-use tokens mailed to a new address
+	// to confirm moving an account to it.
+	EmailChangeAudience = "chirpy-email-change"
+)
+
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+	ScopeUserRead    = "user:read"
+	ScopeUserWrite   = "user:write"
+	ScopeSessions    = "sessions"
+	ScopeTokens      = "tokens"
+)
+
+// FirstPartyScopes are granted to tokens issued by our own login and refresh
+// endpoints. Third-party clients get a narrower subset.
+var FirstPartyScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeUserRead, ScopeUserWrite, ScopeSessions, ScopeTokens}
+
+// ThirdPartyScopes are the scopes an OAuth client may be granted. Account
+// settings, sessions and tokens stay out of reach of other people's apps.
+var ThirdPartyScopes = []string{ScopeChirpsRead, ScopeChirpsWrite}
+
+// Claims is the validated content of an access token.
+type Claims struct {
+	UserID   uuid.UUID
+	Issuer   string
+	Audience []string
+	Scopes   []string
+	TokenID  string
+	// ClientID is set on tokens issued to an OAuth client.
+	ClientID  string
+	ExpiresAt time.Time
+}
+
+func (c Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// accessClaims is the wire format. Scopes are a space separated string as in
+// RFC 8693.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+func (c *accessClaims) toClaims() (Claims, error) {
+	userID, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return Claims{}, err
+	}
+	claims := Claims{
+		UserID:   userID,
+		Issuer:   c.Issuer,
+		Audience: c.Audience,
+		Scopes:   strings.Fields(c.Scope),
+		TokenID:  c.ID,
+		ClientID: c.ClientID,
+	}
+	if c.ExpiresAt != nil {
+		claims.ExpiresAt = c.ExpiresAt.Time
+	}
+	return claims, nil
+}
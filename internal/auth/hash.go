@@ -1,24 +1,201 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// HashPassword hashes with bcrypt at the default cost. User passwords go
+// through a Hasher instead so the algorithm can be upgraded.
 func HashPassword(password string) (string, error) {
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return BcryptHasher{Cost: bcrypt.DefaultCost}.Hash(password)
+}
+
+// CheckPasswordHash verifies a password against a hash in any supported
+// format.
+func CheckPasswordHash(hash, password string) error {
+	return NewHasher(BcryptHasher{Cost: bcrypt.DefaultCost}, Argon2idHasher{}).Verify(hash, password)
+}
+
+// PasswordHasher is one password hashing algorithm.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) error
+	// Recognizes reports whether hash was produced by this algorithm.
+	Recognizes(hash string) bool
+	// Outdated reports whether a hash this algorithm recognizes was made
+	// with weaker parameters than the current ones.
+	Outdated(hash string) bool
+}
+
+// Hasher hashes new passwords with a preferred algorithm while still
+// verifying hashes made by older ones.
+type Hasher struct {
+	preferred PasswordHasher
+	legacy    []PasswordHasher
+}
+
+func NewHasher(preferred PasswordHasher, legacy ...PasswordHasher) *Hasher {
+	return &Hasher{preferred: preferred, legacy: legacy}
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+func (h *Hasher) Verify(hash, password string) error {
+	for _, hasher := range append([]PasswordHasher{h.preferred}, h.legacy...) {
+		if hasher.Recognizes(hash) {
+			return hasher.Verify(hash, password)
+		}
+	}
+	return errors.New("Unknown password hash format")
+}
+
+// NeedsRehash reports whether a stored hash should be replaced the next time
+// the plaintext password is available, i.e. on a successful login.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	return !h.preferred.Recognizes(hash) || h.preferred.Outdated(hash)
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (b BcryptHasher) Hash(password string) (string, error) {
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
 	if err != nil {
 		return "", errors.New("Error hashing password")
 	}
 	return string(hashedPass), nil
 }
 
-func CheckPasswordHash(hash, password string) error {
-
+func (b BcryptHasher) Verify(hash, password string) error {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	if err != nil {
 		return errors.New("Can't compare hash and pass")
 	}
 	return nil
 }
+
+func (b BcryptHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (b BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < b.Cost
+}
+
+// Argon2idParams follow the names used in the PHC string format.
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams are the OWASP recommended minimums.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Validate rejects parameters argon2 can't work with. A zero iteration count
+// or parallelism would make it panic.
+func (p Argon2idParams) Validate() error {
+	if p.Memory < 1 || p.Iterations < 1 || p.Parallelism < 1 || p.KeyLength < 1 {
+		return errors.New("Argon2id memory, iterations, parallelism and key length must be at least 1")
+	}
+	return nil
+}
+
+// Argon2idHasher stores hashes as PHC strings:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+func (a Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.New("Error hashing password")
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Params.Iterations, a.Params.Memory, a.Params.Parallelism, a.Params.KeyLength)
+
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Params.Memory, a.Params.Iterations, a.Params.Parallelism,
+		enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+func (a Argon2idHasher) Verify(hash, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return errors.New("Can't compare hash and pass")
+	}
+	return nil
+}
+
+func (a Argon2idHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (a Argon2idHasher) Outdated(hash string) bool {
+	params, _, _, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory < a.Params.Memory ||
+		params.Iterations < a.Params.Iterations ||
+		params.Parallelism < a.Params.Parallelism ||
+		params.KeyLength < a.Params.KeyLength
+}
+
+func decodeArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, errors.New("Invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, errors.New("Unsupported argon2 version")
+	}
+
+	var params Argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, errors.New("Invalid argon2id parameters")
+	}
+
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, errors.New("Invalid argon2id salt")
+	}
+	key, err := enc.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, errors.New("Invalid argon2id hash")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	if err := params.Validate(); err != nil {
+		return Argon2idParams{}, nil, nil, errors.New("Invalid argon2id parameters")
+	}
+	return params, salt, key, nil
+}
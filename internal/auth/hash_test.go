@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idParams = Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher(t *testing.T) {
+	h := Argon2idHasher{Params: testArgon2idParams}
+	hash, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal("couldn't hash")
+	}
+
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=1024,t=1,p=1\$[A-Za-z0-9+/]+\$[A-Za-z0-9+/]+$`, hash)
+	assert.NoError(t, h.Verify(hash, "correct horse"))
+	assert.Error(t, h.Verify(hash, "battery staple"))
+	assert.False(t, h.Outdated(hash))
+
+	stronger := Argon2idHasher{Params: testArgon2idParams}
+	stronger.Params.Iterations = 2
+	assert.True(t, stronger.Outdated(hash))
+}
+
+func TestArgon2idParamsValidate(t *testing.T) {
+	assert.NoError(t, testArgon2idParams.Validate())
+	for _, zero := range []func(*Argon2idParams){
+		func(p *Argon2idParams) { p.Memory = 0 },
+		func(p *Argon2idParams) { p.Iterations = 0 },
+		func(p *Argon2idParams) { p.Parallelism = 0 },
+		func(p *Argon2idParams) { p.KeyLength = 0 },
+	} {
+		params := testArgon2idParams
+		zero(&params)
+		assert.Error(t, params.Validate())
+	}
+
+	// A stored hash with t=0 is rejected rather than passed to argon2.
+	h := Argon2idHasher{Params: testArgon2idParams}
+	assert.Error(t, h.Verify("$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaA", "x"))
+}
+
+func TestHasherUpgradesFromBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal("couldn't hash")
+	}
+
+	h := NewHasher(Argon2idHasher{Params: testArgon2idParams}, BcryptHasher{Cost: bcrypt.DefaultCost})
+	assert.NoError(t, h.Verify(string(legacy), "correct horse"))
+	assert.True(t, h.NeedsRehash(string(legacy)))
+
+	upgraded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal("couldn't hash")
+	}
+	assert.False(t, h.NeedsRehash(upgraded))
+	assert.NoError(t, CheckPasswordHash(upgraded, "correct horse"))
+}
+
+func TestBcryptCostUpgrade(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal("couldn't hash")
+	}
+	h := NewHasher(BcryptHasher{Cost: bcrypt.MinCost + 1})
+	assert.True(t, h.NeedsRehash(string(legacy)))
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// "password123" in plain text and "letmein123" as a HIBP style digest.
+	data := "password123\nE286977B13F1A89E20D0459207545D15FE1EBA08:17043\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal("couldn't write breach list")
+	}
+
+	p := NewPasswordPolicy(8, 64)
+	if err := p.LoadBreachedPasswords(path); err != nil {
+		t.Fatal("couldn't load breach list")
+	}
+
+	assert.Error(t, p.Validate("short"))
+	assert.Error(t, p.Validate("password123"))
+	assert.Error(t, p.Validate("letmein123"))
+	assert.NoError(t, p.Validate("correct horse battery"))
+}
@@ -11,15 +11,56 @@ import (
 )
 
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   userID.String(),
+	return NewKeySet(NewHMACKey(tokenSecret)).MakeJWT(userID, expiresIn)
+}
+
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return NewKeySet(NewHMACKey(tokenSecret)).ValidateJWT(tokenString)
+}
+
+// MakeJWT issues a first-party access token carrying every scope.
+func (ks *KeySet) MakeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return ks.MakeScopedJWT(userID, DefaultAudience, FirstPartyScopes, expiresIn)
+}
+
+// MakeScopedJWT issues an access token for a specific audience limited to
+// the given scopes.
+func (ks *KeySet) MakeScopedJWT(userID uuid.UUID, audience string, scopes []string, expiresIn time.Duration) (string, error) {
+	return ks.sign(userID, audience, uuid.NewString(), strings.Join(scopes, " "), "", expiresIn)
+}
+
+// MakeClientJWT issues an access token to a third-party OAuth client acting
+// on behalf of a user.
+func (ks *KeySet) MakeClientJWT(userID uuid.UUID, clientID string, scopes []string, expiresIn time.Duration) (string, error) {
+	return ks.sign(userID, DefaultAudience, uuid.NewString(), strings.Join(scopes, " "), clientID, expiresIn)
+}
+
+// MakeSingleUseJWT issues a token for a one-off action such as verifying an
+// email address. The tokenID is the database row that records whether the
+// token has been used.
+func (ks *KeySet) MakeSingleUseJWT(userID uuid.UUID, audience string, tokenID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return ks.sign(userID, audience, tokenID.String(), "", "", expiresIn)
+}
+
+func (ks *KeySet) sign(userID uuid.UUID, audience, tokenID, scope, clientID string, expiresIn time.Duration) (string, error) {
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+			ID:        tokenID,
+		},
+		Scope:    scope,
+		ClientID: clientID,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(tokenSecret))
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	if ks.signing.KeyID != "" {
+		token.Header["kid"] = ks.signing.KeyID
+	}
+	signed, err := token.SignedString(ks.signing.signKey)
 	if err != nil {
 		return "", errors.New("Failed to sign token")
 	}
@@ -27,26 +68,33 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return signed, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
-
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(tokenSecret), nil
-	})
-
-	if err != nil || !token.Valid {
+// ValidateJWT checks a first-party access token and returns its subject.
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.ParseJWT(tokenString, DefaultAudience)
+	if err != nil {
 		return uuid.UUID{}, err
 	}
+	return claims.UserID, nil
+}
+
+// ParseJWT verifies signature, expiry, issuer and audience and returns the
+// token's claims so callers can check scopes.
+func (ks *KeySet) ParseJWT(tokenString, audience string) (Claims, error) {
+	claims := &accessClaims{}
 
-	userID, err := uuid.Parse(claims.Subject)
+	token, err := jwt.ParseWithClaims(tokenString, claims, ks.keyFunc,
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return uuid.UUID{}, err
+		return Claims{}, err
+	}
+	if !token.Valid {
+		return Claims{}, errors.New("Invalid token")
 	}
 
-	return userID, nil
+	return claims.toClaims()
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
@@ -24,3 +25,41 @@ func TestMakeJWT(t *testing.T) {
 	assert.Equal(t, userIdTest, id)
 
 }
+
+func TestScopedJWT(t *testing.T) {
+	ks := NewKeySet(NewHMACKey(TOKEN_SECRET_TEST))
+	userID := uuid.New()
+	token, err := ks.MakeScopedJWT(userID, "partner-app", []string{ScopeChirpsRead}, time.Hour)
+	if err != nil {
+		t.Fatal("couldn't create token")
+	}
+
+	claims, err := ks.ParseJWT(token, "partner-app")
+	if err != nil {
+		t.Fatal("err validating")
+	}
+	assert.Equal(t, userID, claims.UserID)
+	assert.Equal(t, TokenIssuer, claims.Issuer)
+	assert.NotEmpty(t, claims.TokenID)
+	assert.True(t, claims.HasScope(ScopeChirpsRead))
+	assert.False(t, claims.HasScope(ScopeChirpsWrite))
+
+	_, err = ks.ValidateJWT(token)
+	assert.Error(t, err, "token for another audience must be rejected")
+}
+
+func TestJWTRejectsWrongIssuer(t *testing.T) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    "not-chirpy",
+		Audience:  jwt.ClaimStrings{DefaultAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Subject:   uuid.NewString(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(TOKEN_SECRET_TEST))
+	if err != nil {
+		t.Fatal("couldn't sign token")
+	}
+
+	_, err = ValidateJWT(token, TOKEN_SECRET_TEST)
+	assert.Error(t, err)
+}
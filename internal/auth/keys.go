@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a single JWT key. Asymmetric keys carry a key ID derived from
+// their public half so tokens can say which key signed them.
+type SigningKey struct {
+	KeyID     string
+	Method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// NewHMACKey wraps the legacy shared SECRET_TOKEN. It has no key ID and is
+// never published in the JWKS.
+func NewHMACKey(secret string) *SigningKey {
+	return &SigningKey{
+		Method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// NewSigningKey builds a key that can both sign and verify. Ed25519 keys sign
+// with EdDSA and RSA keys with RS256.
+func NewSigningKey(private crypto.Signer) (*SigningKey, error) {
+	key, err := NewVerificationKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.signKey = private
+	return key, nil
+}
+
+// NewVerificationKey builds a key that can only verify, e.g. a retired
+// signing key that is kept around until the tokens it issued expire.
+func NewVerificationKey(public crypto.PublicKey) (*SigningKey, error) {
+	key := &SigningKey{verifyKey: public}
+	switch public.(type) {
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	default:
+		return nil, errors.New("Unsupported key type")
+	}
+
+	jwk, err := key.JWK()
+	if err != nil {
+		return nil, err
+	}
+	key.KeyID = jwk.thumbprint()
+	return key, nil
+}
+
+// ParsePrivateKeyPEM reads a PKCS#8 encoded Ed25519 or RSA private key.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("No PEM block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes); rsaErr == nil {
+			return rsaKey, nil
+		}
+		return nil, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("Unsupported key type")
+	}
+	return signer, nil
+}
+
+// ParsePublicKeyPEM reads a PKIX encoded Ed25519 or RSA public key.
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("No PEM block found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// JWK is the public half of a key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *SigningKey) JWK() (JWK, error) {
+	enc := base64.RawURLEncoding
+	switch pub := k.verifyKey.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     k.KeyID,
+			Use:       "sig",
+			Algorithm: k.Method.Alg(),
+			Curve:     "Ed25519",
+			X:         enc.EncodeToString(pub),
+		}, nil
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     k.KeyID,
+			Use:       "sig",
+			Algorithm: k.Method.Alg(),
+			N:         enc.EncodeToString(pub.N.Bytes()),
+			E:         enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	}
+	return JWK{}, errors.New("Key has no public JWK form")
+}
+
+// thumbprint is the RFC 7638 SHA-256 thumbprint, used as the key ID.
+func (j JWK) thumbprint() string {
+	var members any
+	switch j.KeyType {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Curve, j.KeyType, j.X}
+	default:
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.KeyType, j.N}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// KeySet signs new tokens with a single current key and accepts tokens from
+// any key it holds, which lets keys be rotated without logging everyone out.
+type KeySet struct {
+	signing *SigningKey
+	byID    map[string]*SigningKey
+	legacy  *SigningKey
+}
+
+func NewKeySet(signing *SigningKey, verification ...*SigningKey) *KeySet {
+	ks := &KeySet{signing: signing, byID: map[string]*SigningKey{}}
+	for _, key := range append([]*SigningKey{signing}, verification...) {
+		if key.KeyID == "" {
+			ks.legacy = key
+			continue
+		}
+		ks.byID[key.KeyID] = key
+	}
+	return ks
+}
+
+// keyFunc picks the verification key named by the kid header. Tokens without
+// a kid were issued before asymmetric keys and fall back to the HMAC secret.
+// The token's alg must match the key, otherwise a public key could be passed
+// off as an HMAC secret.
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	key := ks.legacy
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = ks.byID[kid]
+	}
+	if key == nil {
+		return nil, errors.New("Unknown signing key")
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.verifyKey, nil
+}
+
+// JWKS lists every public verification key, for other services to validate
+// Chirpy tokens without holding a secret.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.byID {
+		jwk, err := key.JWK()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEd25519Key(t *testing.T) *SigningKey {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("couldn't generate key")
+	}
+	key, err := NewSigningKey(private)
+	if err != nil {
+		t.Fatal("couldn't wrap key")
+	}
+	return key
+}
+
+func TestKeySetSignAndValidate(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("couldn't generate rsa key")
+	}
+	rsaKey, err := NewSigningKey(rsaPrivate)
+	if err != nil {
+		t.Fatal("couldn't wrap rsa key")
+	}
+
+	for _, key := range []*SigningKey{newEd25519Key(t), rsaKey} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			ks := NewKeySet(key)
+			userID := uuid.New()
+			token, err := ks.MakeJWT(userID, time.Hour)
+			if err != nil {
+				t.Fatal("couldn't create token")
+			}
+			id, err := ks.ValidateJWT(token)
+			if err != nil {
+				t.Fatal("err validating")
+			}
+			assert.Equal(t, userID, id)
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey := newEd25519Key(t)
+	newKey := newEd25519Key(t)
+	userID := uuid.New()
+
+	oldToken, err := NewKeySet(oldKey).MakeJWT(userID, time.Hour)
+	if err != nil {
+		t.Fatal("couldn't create token")
+	}
+
+	rotated := NewKeySet(newKey, oldKey)
+	id, err := rotated.ValidateJWT(oldToken)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, id)
+
+	_, err = NewKeySet(newKey).ValidateJWT(oldToken)
+	assert.Error(t, err, "retired key should no longer validate")
+
+	jwks := rotated.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+}
+
+func TestKeySetLegacyHMAC(t *testing.T) {
+	userID := uuid.New()
+	legacyToken, err := MakeJWT(userID, TOKEN_SECRET_TEST, time.Hour)
+	if err != nil {
+		t.Fatal("couldn't create token")
+	}
+
+	ks := NewKeySet(newEd25519Key(t), NewHMACKey(TOKEN_SECRET_TEST))
+	id, err := ks.ValidateJWT(legacyToken)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, id)
+	assert.Len(t, ks.JWKS().Keys, 1, "hmac secret must not be published")
+
+	// With the secret dropped, as JWT_DISABLE_HMAC does, it is refused.
+	_, err = NewKeySet(newEd25519Key(t)).ValidateJWT(legacyToken)
+	assert.Error(t, err)
+}
+
+func TestKeySetRejectsAlgorithmMismatch(t *testing.T) {
+	key := newEd25519Key(t)
+	hmacKey := NewHMACKey("attacker")
+	hmacKey.KeyID = key.KeyID
+
+	forged, err := NewKeySet(hmacKey).MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatal("couldn't create token")
+	}
+	_, err = NewKeySet(key).ValidateJWT(forged)
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// PasswordPolicy rejects passwords that are too short, too long or known to
+// have appeared in a breach.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// breached holds upper case hex SHA-1 digests, the format the Have I
+	// Been Pwned password dumps use.
+	breached map[string]struct{}
+}
+
+func NewPasswordPolicy(minLength, maxLength int) *PasswordPolicy {
+	return &PasswordPolicy{MinLength: minLength, MaxLength: maxLength, breached: map[string]struct{}{}}
+}
+
+// LoadBreachedPasswords reads a local breach list. Each line is either a
+// plaintext password or a SHA-1 digest, optionally followed by ":count" as in
+// the HIBP downloads.
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if digest, _, _ := strings.Cut(line, ":"); isSHA1Hex(digest) {
+			p.breached[strings.ToUpper(digest)] = struct{}{}
+			continue
+		}
+		p.breached[sha1Hex(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+func (p *PasswordPolicy) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("Password must be at most %d characters", p.MaxLength)
+	}
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return fmt.Errorf("Password has appeared in a data breach, choose another")
+	}
+	return nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
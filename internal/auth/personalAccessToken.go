@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix marks long-lived tokens so they can be told apart
+// from JWTs without a database lookup.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// PersonalAccessTokenScopes are the scopes a personal access token may carry.
+// Managing sessions and other tokens always needs an interactive login.
+var PersonalAccessTokenScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeUserRead, ScopeUserWrite}
+
+func MakePersonalAccessToken() (string, error) {
+	key := make([]byte, 32)
+
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", errors.New("Couldn't make personal access token")
+	}
+	return PersonalAccessTokenPrefix + hex.EncodeToString(key), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
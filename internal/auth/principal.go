@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuthMethod string
+
+const (
+	AuthMethodJWT                 AuthMethod = "jwt"
+	AuthMethodPersonalAccessToken AuthMethod = "pat"
+	AuthMethodAPIKey              AuthMethod = "api_key"
+	AuthMethodOAuth               AuthMethod = "oauth"
+)
+
+// ScopeWebhooks is held only by callers using the shared API key.
+const ScopeWebhooks = "webhooks"
+
+// Principal is whoever made an authenticated request. API key callers are
+// services rather than users and have a nil UserID.
+type Principal struct {
+	UserID  uuid.UUID
+	Method  AuthMethod
+	Scopes  []string
+	TokenID string
+	// ClientID is the OAuth client acting for the user, if any.
+	ClientID uuid.UUID
+	// ExpiresAt is when the credential stops being valid, zero if never.
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether p was granted scope. user:write includes
+// user:read, so tokens issued before user:read existed can still read.
+func (p Principal) HasScope(scope string) bool {
+	if scope == ScopeUserRead && slices.Contains(p.Scopes, ScopeUserWrite) {
+		return true
+	}
+	return slices.Contains(p.Scopes, scope)
+}
+
+type principalContextKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by the authentication
+// middleware. ok is false on optional-auth routes called anonymously.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 )
@@ -16,3 +17,11 @@ func MakeRefreshToken() (string, error) {
 	refreshToken := hex.EncodeToString(key)
 	return refreshToken, nil
 }
+
+// HashToken returns the hex encoded SHA-256 of a refresh or personal access
+// token. Only this value is stored in the database so a leaked table can't be
+// replayed.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatal("couldn't make refresh token")
+	}
+	hashed := HashToken(token)
+
+	assert.NotEqual(t, token, hashed)
+	assert.Len(t, hashed, 64)
+	assert.Equal(t, hashed, HashToken(token))
+}
@@ -0,0 +1,46 @@
+package auth
+
+import "slices"
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermModerateChirps Permission = "chirps:moderate"
+	PermViewMetrics    Permission = "metrics:read"
+	PermResetData      Permission = "data:reset"
+	PermManageLockouts Permission = "lockouts:manage"
+	PermManageRoles    Permission = "roles:manage"
+	PermViewAudit      Permission = "audit:read"
+	PermManageFilters  Permission = "filters:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      {},
+	RoleModerator: {PermModerateChirps},
+	RoleAdmin: {
+		PermModerateChirps,
+		PermViewMetrics,
+		PermResetData,
+		PermManageLockouts,
+		PermManageRoles,
+		PermViewAudit,
+		PermManageFilters,
+	},
+}
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[Role(role)]
+	return ok
+}
+
+func (r Role) Can(perm Permission) bool {
+	return slices.Contains(rolePermissions[r], perm)
+}
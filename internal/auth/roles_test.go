@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolePermissions(t *testing.T) {
+	assert.False(t, RoleUser.Can(PermModerateChirps))
+	assert.True(t, RoleModerator.Can(PermModerateChirps))
+	assert.False(t, RoleModerator.Can(PermManageRoles))
+	assert.True(t, RoleAdmin.Can(PermManageRoles))
+	assert.False(t, Role("superuser").Can(PermViewMetrics))
+
+	assert.True(t, ValidRole("moderator"))
+	assert.False(t, ValidRole("superuser"))
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors from RFC 6238 Appendix B, SHA1 mode.
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	var tests = []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			step := TOTPStep(time.Unix(tt.unix, 0))
+			assert.Equal(t, tt.want, hotp(key, uint64(step), 8))
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	code := hotp([]byte("12345678901234567890"), uint64(TOTPStep(now)), totpDigits)
+
+	step, ok := ValidateTOTP(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, TOTPStep(now), step)
+
+	_, ok = ValidateTOTP(secret, code, now.Add(totpPeriod*time.Second))
+	assert.True(t, ok, "one step of drift is allowed")
+
+	_, ok = ValidateTOTP(secret, code, now.Add(3*totpPeriod*time.Second))
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(secret, "000000", now)
+	assert.False(t, ok)
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal("couldn't make codes")
+	}
+	assert.Len(t, codes, 10)
+	for _, code := range codes {
+		assert.Len(t, code, 11)
+	}
+}
@@ -7,31 +7,33 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, flagged_at)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
-
+    $2,
+    $3
 )
 
-    RETURNING id, created_at, updated_at, body, user_id
+    RETURNING id, created_at, updated_at, body, user_id, flagged_at, hidden_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	FlaggedAt sql.NullTime
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.FlaggedAt)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -39,6 +41,8 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.FlaggedAt,
+		&i.HiddenAt,
 	)
 	return i, err
 }
@@ -54,7 +58,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id 
+SELECT id, created_at, updated_at, body, user_id, flagged_at, hidden_at 
 FROM chirps
 ORDER BY created_at ASC
 `
@@ -74,6 +78,8 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.FlaggedAt,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -89,7 +95,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, flagged_at, hidden_at
 FROM chirps
 WHERE id = $1
 `
@@ -103,12 +109,14 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.FlaggedAt,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
 const getChirpByUserID = `-- name: GetChirpByUserID :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, flagged_at, hidden_at
 FROM chirps
 WHERE user_id = $1
 `
@@ -128,6 +136,8 @@ func (q *Queries) GetChirpByUserID(ctx context.Context, userID uuid.UUID) ([]Chi
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.FlaggedAt,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -141,3 +151,150 @@ func (q *Queries) GetChirpByUserID(ctx context.Context, userID uuid.UUID) ([]Chi
 	}
 	return items, nil
 }
+
+const getVisibleChirpByID = `-- name: GetVisibleChirpByID :one
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.flagged_at, chirps.hidden_at
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1 AND (chirps.user_id = $2
+    OR (chirps.hidden_at IS NULL AND (users.shadow_banned_until IS NULL OR users.shadow_banned_until <= NOW())))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $2 AND user_blocks.blocked_id = chirps.user_id)
+        OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $2)
+)
+`
+
+type GetVisibleChirpByIDParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetVisibleChirpByID(ctx context.Context, arg GetVisibleChirpByIDParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getVisibleChirpByID, arg.ID, arg.ViewerID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.FlaggedAt,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const getVisibleChirps = `-- name: GetVisibleChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.flagged_at, chirps.hidden_at
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE (chirps.user_id = $1
+    OR (chirps.hidden_at IS NULL AND (users.shadow_banned_until IS NULL OR users.shadow_banned_until <= NOW())))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $1 AND user_blocks.blocked_id = chirps.user_id)
+        OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $1)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = $1 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY chirps.created_at ASC
+`
+
+// Hidden chirps and chirps of shadow-banned users are only visible to their
+// author, and chirps are never shown between users where either blocked the
+// other. The timeline also leaves out users the viewer muted. viewer_id is
+// uuid.Nil for anonymous readers.
+func (q *Queries) GetVisibleChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getVisibleChirps, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.FlaggedAt,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVisibleChirpsByUserID = `-- name: GetVisibleChirpsByUserID :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.flagged_at, chirps.hidden_at
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.user_id = $1 AND (chirps.user_id = $2
+    OR (chirps.hidden_at IS NULL AND (users.shadow_banned_until IS NULL OR users.shadow_banned_until <= NOW())))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $2 AND user_blocks.blocked_id = chirps.user_id)
+        OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $2)
+)
+ORDER BY chirps.created_at ASC
+`
+
+type GetVisibleChirpsByUserIDParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetVisibleChirpsByUserID(ctx context.Context, arg GetVisibleChirpsByUserIDParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getVisibleChirpsByUserID, arg.UserID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.FlaggedAt,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hideChirp = `-- name: HideChirp :exec
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, hideChirp, id)
+	return err
+}
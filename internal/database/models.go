@@ -11,28 +11,228 @@ import (
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	EventType string
+	ActorID   uuid.NullUUID
+	Target    string
+	Details   string
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	FlaggedAt sql.NullTime
+	HiddenAt  sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpEvent struct {
+	ID             int64
+	CreatedAt      time.Time
+	Type           string
+	ChirpID        uuid.UUID
+	UserID         uuid.UUID
+	Body           string
+	ChirpCreatedAt time.Time
+}
+
+type EmailVerification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type FilterRule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	List      string
+	Phrase    string
+	Action    string
+	CreatedBy uuid.NullUUID
+}
+
+type ModerationAction struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	ModeratorID  uuid.NullUUID
+	Action       string
+	ReportID     uuid.NullUUID
+	ChirpID      uuid.NullUUID
+	TargetUserID uuid.NullUUID
+	Note         string
+}
+
+type MutedWord struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Kind      string
+	Phrase    string
+	ExpiresAt sql.NullTime
+}
+
+type Notification struct {
+	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
+	Type      string
+	GroupKey  string
+	ChirpID   uuid.NullUUID
+	ActorIds  []uuid.UUID
+	Count     int32
+	Details   string
+	ReadAt    sql.NullTime
+	EventID   string
+}
+
+type NotificationPreference struct {
+	UserID    uuid.UUID
+	Type      string
+	Enabled   bool
+	UpdatedAt time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	Scopes       []string
+	RevokedAt    sql.NullTime
+}
+
+type OauthRefreshToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ClientID  uuid.UUID
+	UserID    uuid.UUID
+	Scopes    []string
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
 }
 
-type User struct {
+type PasswordReset struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	ID         uuid.UUID
+	LastUsedAt sql.NullTime
+	UserAgent  string
+	IpAddress  string
+}
+
+type Report struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ChirpID        uuid.NullUUID
+	ReporterID     uuid.NullUUID
+	Reason         string
+	Details        string
+	Status         string
+	ClaimedBy      uuid.NullUUID
+	ClaimedAt      sql.NullTime
+	ResolvedBy     uuid.NullUUID
+	ResolvedAt     sql.NullTime
+	Resolution     string
+	ResolutionNote string
+}
+
+type User struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	TotpSecret          sql.NullString
+	TotpEnabled         bool
+	TotpLastUsedStep    int64
+	EmailVerifiedAt     sql.NullTime
+	Role                string
+	DeletionScheduledAt sql.NullTime
+	DisplayName         sql.NullString
+	Bio                 sql.NullString
+	SuspendedUntil      sql.NullTime
+	SuspensionReason    string
+	ShadowBannedUntil   sql.NullTime
+	ShadowBanReason     string
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserIdentity struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Issuer      string
+	Subject     string
+	Email       string
+	LastLoginAt sql.NullTime
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
 }
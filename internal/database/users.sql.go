@@ -7,10 +7,37 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :exec
+UPDATE users
+SET
+    deletion_scheduled_at = NULL,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	return err
+}
+
+const countUsersWithRole = `-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1
+`
+
+func (q *Queries) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersWithRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -21,7 +48,7 @@ VALUES (
     $2
 )
 
-    RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+    RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, totp_last_used_step, email_verified_at, role, deletion_scheduled_at, display_name, bio, suspended_until, suspension_reason, shadow_banned_until, shadow_ban_reason
 `
 
 type CreateUserParams struct {
@@ -39,6 +66,18 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DisplayName,
+		&i.Bio,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedUntil,
+		&i.ShadowBanReason,
 	)
 	return i, err
 }
@@ -52,8 +91,71 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const deleteUsersScheduledBefore = `-- name: DeleteUsersScheduledBefore :many
+DELETE FROM users
+WHERE deletion_scheduled_at <= $1
+RETURNING id
+`
+
+func (q *Queries) DeleteUsersScheduledBefore(ctx context.Context, deletionScheduledAt sql.NullTime) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, deleteUsersScheduledBefore, deletionScheduledAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const disableTOTP = `-- name: DisableTOTP :exec
+UPDATE users
+SET
+    totp_secret = NULL,
+    totp_enabled = false,
+    totp_last_used_step = 0,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableTOTP, id)
+	return err
+}
+
+const enableTOTP = `-- name: EnableTOTP :exec
+UPDATE users
+SET
+    totp_enabled = true,
+    totp_last_used_step = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type EnableTOTPParams struct {
+	ID               uuid.UUID
+	TotpLastUsedStep int64
+}
+
+func (q *Queries) EnableTOTP(ctx context.Context, arg EnableTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, enableTOTP, arg.ID, arg.TotpLastUsedStep)
+	return err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, totp_last_used_step, email_verified_at, role, deletion_scheduled_at, display_name, bio, suspended_until, suspension_reason, shadow_banned_until, shadow_ban_reason FROM users
 WHERE email = $1
 `
 
@@ -67,12 +169,24 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DisplayName,
+		&i.Bio,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedUntil,
+		&i.ShadowBanReason,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, totp_last_used_step, email_verified_at, role, deletion_scheduled_at, display_name, bio, suspended_until, suspension_reason, shadow_banned_until, shadow_ban_reason FROM users
 WHERE id = $1
 `
 
@@ -86,10 +200,212 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DisplayName,
+		&i.Bio,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedUntil,
+		&i.ShadowBanReason,
 	)
 	return i, err
 }
 
+const liftExpiredShadowBans = `-- name: LiftExpiredShadowBans :many
+UPDATE users
+SET
+    shadow_banned_until = NULL,
+    shadow_ban_reason = '',
+    updated_at = NOW()
+WHERE shadow_banned_until <= NOW()
+RETURNING id
+`
+
+func (q *Queries) LiftExpiredShadowBans(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, liftExpiredShadowBans)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const liftExpiredSuspensions = `-- name: LiftExpiredSuspensions :many
+UPDATE users
+SET
+    suspended_until = NULL,
+    suspension_reason = '',
+    updated_at = NOW()
+WHERE suspended_until <= NOW()
+RETURNING id
+`
+
+func (q *Queries) LiftExpiredSuspensions(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, liftExpiredSuspensions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const liftShadowBan = `-- name: LiftShadowBan :execrows
+UPDATE users
+SET
+    shadow_banned_until = NULL,
+    shadow_ban_reason = '',
+    updated_at = NOW()
+WHERE id = $1 AND shadow_banned_until IS NOT NULL
+`
+
+func (q *Queries) LiftShadowBan(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, liftShadowBan, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const liftSuspension = `-- name: LiftSuspension :execrows
+UPDATE users
+SET
+    suspended_until = NULL,
+    suspension_reason = '',
+    updated_at = NOW()
+WHERE id = $1 AND suspended_until IS NOT NULL
+`
+
+func (q *Queries) LiftSuspension(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, liftSuspension, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :exec
+UPDATE users
+SET
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markEmailVerified, id)
+	return err
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :exec
+UPDATE users
+SET
+    deletion_scheduled_at = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type ScheduleUserDeletionParams struct {
+	ID                  uuid.UUID
+	DeletionScheduledAt sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
+	return err
+}
+
+const setTOTPSecret = `-- name: SetTOTPSecret :exec
+UPDATE users
+SET
+    totp_secret = $2,
+    totp_enabled = false,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type SetTOTPSecretParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setTOTPSecret, arg.ID, arg.TotpSecret)
+	return err
+}
+
+const shadowBanUser = `-- name: ShadowBanUser :exec
+UPDATE users
+SET
+    shadow_banned_until = $2,
+    shadow_ban_reason = $3,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type ShadowBanUserParams struct {
+	ID                uuid.UUID
+	ShadowBannedUntil sql.NullTime
+	ShadowBanReason   string
+}
+
+func (q *Queries) ShadowBanUser(ctx context.Context, arg ShadowBanUserParams) error {
+	_, err := q.db.ExecContext(ctx, shadowBanUser, arg.ID, arg.ShadowBannedUntil, arg.ShadowBanReason)
+	return err
+}
+
+const suspendUser = `-- name: SuspendUser :exec
+UPDATE users
+SET
+    suspended_until = $2,
+    suspension_reason = $3,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type SuspendUserParams struct {
+	ID               uuid.UUID
+	SuspendedUntil   sql.NullTime
+	SuspensionReason string
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) error {
+	_, err := q.db.ExecContext(ctx, suspendUser, arg.ID, arg.SuspendedUntil, arg.SuspensionReason)
+	return err
+}
+
 const updateChirpyRed = `-- name: UpdateChirpyRed :exec
 UPDATE users
 SET 
@@ -122,3 +438,127 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 	_, err := q.db.ExecContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
 	return err
 }
+
+const updateUserEmail = `-- name: UpdateUserEmail :exec
+UPDATE users
+SET
+    email = $2,
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserEmail, arg.ID, arg.Email)
+	return err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET
+    hashed_password = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET
+    display_name = $2,
+    bio = $3,
+    updated_at = NOW()
+WHERE id = $1 AND updated_at = $4
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, totp_last_used_step, email_verified_at, role, deletion_scheduled_at, display_name, bio, suspended_until, suspension_reason, shadow_banned_until, shadow_ban_reason
+`
+
+type UpdateUserProfileParams struct {
+	ID          uuid.UUID
+	DisplayName sql.NullString
+	Bio         sql.NullString
+	UpdatedAt   time.Time
+}
+
+// Only applies if the row is unchanged since the caller read updated_at, so
+// concurrent edits can't silently overwrite each other.
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.ID,
+		arg.DisplayName,
+		arg.Bio,
+		arg.UpdatedAt,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DisplayName,
+		&i.Bio,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedUntil,
+		&i.ShadowBanReason,
+	)
+	return i, err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :exec
+UPDATE users
+SET
+    role = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserRole, arg.ID, arg.Role)
+	return err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_used_step = $2
+WHERE id = $1 AND totp_last_used_step < $2
+`
+
+type UseTOTPStepParams struct {
+	ID               uuid.UUID
+	TotpLastUsedStep int64
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.ID, arg.TotpLastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
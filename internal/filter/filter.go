@@ -0,0 +1,359 @@
+// Package filter matches text against word lists in a way that survives the
+// usual tricks for slipping words past a filter: punctuation, mixed case,
+// look-alike case variants and leetspeak.
+package filter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Action is what happens to text that matches a rule.
+type Action string
+
+const (
+	// ActionMask replaces the matched words with asterisks.
+	ActionMask Action = "mask"
+	// ActionFlag keeps the text as is but sends it for review.
+	ActionFlag Action = "flag"
+	// ActionReject refuses the text outright.
+	ActionReject Action = "reject"
+)
+
+func ValidAction(action string) bool {
+	switch Action(action) {
+	case ActionMask, ActionFlag, ActionReject:
+		return true
+	}
+	return false
+}
+
+// Mask is what masked words are replaced with.
+const Mask = "****"
+
+// Rule is a word or phrase and the action to take when it appears.
+type Rule struct {
+	Phrase string
+	Action Action
+}
+
+// Match is a rule that matched, with the text it matched.
+type Match struct {
+	Phrase string
+	Action Action
+	Text   string
+}
+
+// Result is the outcome of checking a piece of text.
+type Result struct {
+	// Text is the input with every ActionMask match masked.
+	Text    string
+	Matches []Match
+}
+
+// Has reports whether any rule with the given action matched.
+func (r Result) Has(action Action) bool {
+	for _, m := range r.Matches {
+		if m.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Phrases returns the distinct rule phrases that matched with the given
+// action.
+func (r Result) Phrases(action Action) []string {
+	var phrases []string
+	seen := map[string]bool{}
+	for _, m := range r.Matches {
+		if m.Action == action && !seen[m.Phrase] {
+			seen[m.Phrase] = true
+			phrases = append(phrases, m.Phrase)
+		}
+	}
+	return phrases
+}
+
+// leet maps symbols and digits commonly used in place of letters.
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'9': 'g',
+	'@': 'a',
+	'$': 's',
+	'!': 'i',
+	'|': 'l',
+	'+': 't',
+}
+
+// fold maps every case variant of a rune to the same lower case rune, which
+// also covers look-alikes such as the Kelvin sign or long s.
+func fold(r rune) rune {
+	lowest := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < lowest {
+			lowest = f
+		}
+	}
+	return unicode.ToLower(lowest)
+}
+
+func isWordRune(r rune) bool {
+	_, isLeet := leet[r]
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || isLeet
+}
+
+func isLetterOrDigit(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+func normalizeWord(runes []rune) string {
+	var b strings.Builder
+	for _, r := range runes {
+		if l, ok := leet[r]; ok {
+			r = l
+		}
+		b.WriteRune(fold(r))
+	}
+	return b.String()
+}
+
+// token is one word of the input. full is the normalized word including any
+// leet symbols at its edges, core the normalized word without them, so
+// "kerfuffle!" can match "kerfuffle" while "sh!t" still matches as a whole.
+type token struct {
+	start, end         int
+	coreStart, coreEnd int
+	full, core         string
+}
+
+func tokenize(text string) []token {
+	var tokens []token
+	var runes []rune
+	var offsets []int
+	flush := func(end int) {
+		if len(runes) == 0 {
+			return
+		}
+		first, last := 0, len(runes)
+		for first < last && !isLetterOrDigit(runes[first]) {
+			first++
+		}
+		for last > first && !isLetterOrDigit(runes[last-1]) {
+			last--
+		}
+		if first == last {
+			// Only symbols, like "!!" or "$", isn't a word.
+			runes, offsets = runes[:0], offsets[:0]
+			return
+		}
+		t := token{start: offsets[0], end: end, full: normalizeWord(runes)}
+		t.coreStart, t.coreEnd = t.start, t.end
+		t.core = t.full
+		if first > 0 || last < len(runes) {
+			t.coreStart = offsets[first]
+			t.coreEnd = end
+			if last < len(runes) {
+				t.coreEnd = offsets[last]
+			}
+			t.core = normalizeWord(runes[first:last])
+		}
+		tokens = append(tokens, t)
+		runes, offsets = runes[:0], offsets[:0]
+	}
+	for i, r := range text {
+		if isWordRune(r) {
+			runes = append(runes, r)
+			offsets = append(offsets, i)
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+	return tokens
+}
+
+// Normalize returns the canonical form of a phrase, as rules are matched:
+// words folded and de-leeted, separated by single spaces. It returns "" if
+// the phrase has no words.
+func Normalize(phrase string) string {
+	var words []string
+	for _, t := range tokenize(phrase) {
+		words = append(words, t.core)
+	}
+	return strings.Join(words, " ")
+}
+
+type compiledRule struct {
+	phrase string
+	words  []string
+	action Action
+}
+
+// Matcher checks text against a fixed set of rules. It is safe for
+// concurrent use; to change the rules, compile a new Matcher.
+type Matcher struct {
+	// byFirstWord indexes rules by their first word, longest phrase first.
+	byFirstWord map[string][]compiledRule
+}
+
+// Compile builds a Matcher. Rules that normalize to nothing are skipped.
+// When the same phrase appears twice the more severe action wins.
+func Compile(rules []Rule) *Matcher {
+	byPhrase := map[string]compiledRule{}
+	for _, rule := range rules {
+		phrase := Normalize(rule.Phrase)
+		if phrase == "" || !ValidAction(string(rule.Action)) {
+			continue
+		}
+		if existing, ok := byPhrase[phrase]; ok && severity(existing.action) >= severity(rule.Action) {
+			continue
+		}
+		byPhrase[phrase] = compiledRule{phrase: phrase, words: strings.Split(phrase, " "), action: rule.Action}
+	}
+
+	m := &Matcher{byFirstWord: map[string][]compiledRule{}}
+	for _, rule := range byPhrase {
+		first := rule.words[0]
+		rules := append(m.byFirstWord[first], rule)
+		for i := len(rules) - 1; i > 0 && len(rules[i].words) > len(rules[i-1].words); i-- {
+			rules[i], rules[i-1] = rules[i-1], rules[i]
+		}
+		m.byFirstWord[first] = rules
+	}
+	return m
+}
+
+func severity(action Action) int {
+	switch action {
+	case ActionMask:
+		return 1
+	case ActionFlag:
+		return 2
+	case ActionReject:
+		return 3
+	}
+	return 0
+}
+
+// Len returns the number of distinct rules.
+func (m *Matcher) Len() int {
+	n := 0
+	for _, rules := range m.byFirstWord {
+		n += len(rules)
+	}
+	return n
+}
+
+// matchAt tries every rule starting at tokens[i]. It returns the rule and
+// the byte span it covers.
+func (m *Matcher) matchAt(tokens []token, i int) (compiledRule, int, int, bool) {
+	for _, useCore := range []bool{false, true} {
+		first := tokens[i].full
+		if useCore {
+			if tokens[i].core == tokens[i].full {
+				continue
+			}
+			first = tokens[i].core
+		}
+		for _, rule := range m.byFirstWord[first] {
+			if i+len(rule.words) > len(tokens) {
+				continue
+			}
+			last := tokens[i+len(rule.words)-1]
+			ok := true
+			for j, word := range rule.words[1:] {
+				t := tokens[i+1+j]
+				// Only the last word may have trailing punctuation.
+				if t.full != word && !(t.core == word && i+1+j == i+len(rule.words)-1) {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+			start := tokens[i].start
+			if useCore {
+				start = tokens[i].coreStart
+			}
+			end := last.end
+			if last.full != rule.words[len(rule.words)-1] {
+				end = last.coreEnd
+			}
+			return rule, start, end, true
+		}
+	}
+	return compiledRule{}, 0, 0, false
+}
+
+// Check finds every rule in text and masks the ActionMask matches.
+func (m *Matcher) Check(text string) Result {
+	tokens := tokenize(text)
+	var b strings.Builder
+	var matches []Match
+	written := 0
+	for i := 0; i < len(tokens); {
+		rule, start, end, ok := m.matchAt(tokens, i)
+		if !ok {
+			i++
+			continue
+		}
+		matches = append(matches, Match{Phrase: rule.phrase, Action: rule.action, Text: text[start:end]})
+		if rule.action == ActionMask {
+			b.WriteString(text[written:start])
+			b.WriteString(Mask)
+			written = end
+		}
+		i += len(rule.words)
+	}
+	b.WriteString(text[written:])
+	return Result{Text: b.String(), Matches: matches}
+}
+
+// NormalizeHashtag returns the canonical form of a hashtag, with or without
+// its leading '#', as Hashtags reports it. It returns "" if tag isn't a
+// single hashtag.
+func NormalizeHashtag(tag string) string {
+	runes := []rune(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if len(runes) == 0 {
+		return ""
+	}
+	for _, r := range runes {
+		if !isLetterOrDigit(r) {
+			return ""
+		}
+	}
+	return normalizeWord(runes)
+}
+
+// Hashtags returns the distinct normalized hashtags in text, in order. A '#'
+// only starts a hashtag at the beginning of a word, so "C#" isn't one.
+func Hashtags(text string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && isWordRune(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isLetterOrDigit(runes[end]) {
+			end++
+		}
+		if end == i+1 {
+			continue
+		}
+		if tag := normalizeWord(runes[i+1 : end]); !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+		i = end - 1
+	}
+	return tags
+}
@@ -0,0 +1,76 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "kerfuffle", Normalize("KERFUFFLE"))
+	assert.Equal(t, "kerfuffle", Normalize("  k3rfuffl3! "))
+	assert.Equal(t, "kelvin", Normalize("\u212Aelvin"))
+	assert.Equal(t, "big kerfuffle", Normalize("Big,  kerfuffle."))
+	assert.Equal(t, "", Normalize("?!."))
+}
+
+func TestCheck(t *testing.T) {
+	m := Compile([]Rule{
+		{Phrase: "kerfuffle", Action: ActionMask},
+		{Phrase: "sharbert", Action: ActionMask},
+		{Phrase: "fornax", Action: ActionFlag},
+		{Phrase: "fornax", Action: ActionMask},
+		{Phrase: "total disaster", Action: ActionReject},
+		{Phrase: "   ", Action: ActionMask},
+	})
+	assert.Equal(t, 4, m.Len())
+
+	tests := []struct {
+		text    string
+		want    string
+		actions []Action
+	}{
+		{"I had so much fun kerfuffle", "I had so much fun ****", []Action{ActionMask}},
+		{"Kerfuffle! what a day", "****! what a day", []Action{ActionMask}},
+		{"you are SHARBERT.", "you are ****.", []Action{ActionMask}},
+		{"k3rfuff|e and $harbert", "**** and ****", []Action{ActionMask, ActionMask}},
+		{"(kerfuffle)", "(****)", []Action{ActionMask}},
+		{"kerfuffles are fine", "kerfuffles are fine", nil},
+		{"I fornax you", "I fornax you", []Action{ActionFlag}},
+		{"what a Total  Disaster!", "what a Total  Disaster!", []Action{ActionReject}},
+		{"totally disastrous", "totally disastrous", nil},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			result := m.Check(tt.text)
+			assert.Equal(t, tt.want, result.Text)
+			var actions []Action
+			for _, match := range result.Matches {
+				actions = append(actions, match.Action)
+			}
+			assert.Equal(t, tt.actions, actions)
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	m := Compile([]Rule{
+		{Phrase: "kerfuffle", Action: ActionMask},
+		{Phrase: "fornax", Action: ActionFlag},
+	})
+	result := m.Check("fornax kerfuffle FORNAX")
+	assert.True(t, result.Has(ActionFlag))
+	assert.False(t, result.Has(ActionReject))
+	assert.Equal(t, []string{"fornax"}, result.Phrases(ActionFlag))
+}
+
+func TestHashtags(t *testing.T) {
+	assert.Equal(t, "golang", NormalizeHashtag("#GoLang"))
+	assert.Equal(t, "golang", NormalizeHashtag("golang"))
+	assert.Equal(t, "", NormalizeHashtag("#"))
+	assert.Equal(t, "", NormalizeHashtag("#two words"))
+
+	assert.Equal(t, []string{"golang", "chirpy"}, Hashtags("#GoLang and #chirpy, again #golang!"))
+	assert.Nil(t, Hashtags("C# and a#b and # alone"))
+}
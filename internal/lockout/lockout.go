@@ -0,0 +1,250 @@
+// Package lockout slows down and then blocks repeated failed logins, both per
+// account and per client IP.
+package lockout
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	KindAccount Kind = "account"
+	KindIP      Kind = "ip"
+)
+
+type Config struct {
+	// MaxAccountFailures and MaxIPFailures are the failures allowed inside
+	// Window before the account or IP is locked out.
+	MaxAccountFailures int
+	MaxIPFailures      int
+	LockoutDuration    time.Duration
+	// After each failure the next attempt must wait BaseDelay, doubling per
+	// failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long a failure is remembered for.
+	Window time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		LockoutDuration:    15 * time.Minute,
+		BaseDelay:          time.Second,
+		MaxDelay:           30 * time.Second,
+		Window:             time.Hour,
+	}
+}
+
+// Event is emitted for every failure, throttle and lockout so it can be
+// written to the audit log.
+type Event struct {
+	Type     string
+	Kind     Kind
+	Key      string
+	Failures int
+	Time     time.Time
+}
+
+const (
+	EventFailed    = "login.failed"
+	EventThrottled = "login.throttled"
+	EventLocked    = "login.locked"
+	EventUnlocked  = "login.unlocked"
+)
+
+// Decision says whether an attempt may go ahead and, if not, how long the
+// caller has to wait.
+type Decision struct {
+	Allowed    bool
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+// Status is the admin view of one tracked account or IP.
+type Status struct {
+	Kind        Kind       `json:"kind"`
+	Key         string     `json:"key"`
+	Failures    int        `json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until"`
+}
+
+type record struct {
+	failures    int
+	lastFailure time.Time
+	nextAllowed time.Time
+	lockedUntil time.Time
+}
+
+type key struct {
+	kind Kind
+	key  string
+}
+
+type Guard struct {
+	cfg     Config
+	now     func() time.Time
+	onEvent func(Event)
+
+	mu      sync.Mutex
+	records map[key]*record
+}
+
+// New creates a Guard. now is the clock, which tests replace; onEvent may be
+// nil.
+func New(cfg Config, now func() time.Time, onEvent func(Event)) *Guard {
+	if now == nil {
+		now = time.Now
+	}
+	if onEvent == nil {
+		onEvent = func(Event) {}
+	}
+	return &Guard{cfg: cfg, now: now, onEvent: onEvent, records: map[key]*record{}}
+}
+
+// Check must be called before verifying credentials. A denied attempt is
+// not counted as a failure, but it is audited against each account or IP
+// that is over its limit.
+func (g *Guard) Check(account, ip string) Decision {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	decision := Decision{Allowed: true}
+	for _, k := range []key{{KindAccount, account}, {KindIP, ip}} {
+		rec := g.current(k, now)
+		if rec == nil {
+			continue
+		}
+		if now.Before(rec.lockedUntil) {
+			decision.Allowed = false
+			decision.Locked = true
+			decision.RetryAfter = max(decision.RetryAfter, rec.lockedUntil.Sub(now))
+		} else if now.Before(rec.nextAllowed) {
+			decision.Allowed = false
+			decision.RetryAfter = max(decision.RetryAfter, rec.nextAllowed.Sub(now))
+		} else {
+			continue
+		}
+		g.onEvent(Event{Type: EventThrottled, Kind: k.kind, Key: k.key, Time: now})
+	}
+	return decision
+}
+
+func (g *Guard) RecordFailure(account, ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.fail(key{KindAccount, account}, g.cfg.MaxAccountFailures, now)
+	g.fail(key{KindIP, ip}, g.cfg.MaxIPFailures, now)
+
+	if len(g.records) > 10000 {
+		g.sweep(now)
+	}
+}
+
+// RecordSuccess clears the account's failures. The IP keeps its count so one
+// valid login can't reset an attack spread across many accounts.
+func (g *Guard) RecordSuccess(account, ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.records, key{KindAccount, account})
+}
+
+// Unlock clears an account or IP by hand. It reports whether anything was
+// tracked for it.
+func (g *Guard) Unlock(kind Kind, k string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.records[key{kind, k}]; !ok {
+		return false
+	}
+	delete(g.records, key{kind, k})
+	g.onEvent(Event{Type: EventUnlocked, Kind: kind, Key: k, Time: g.now()})
+	return true
+}
+
+// Statuses lists every account and IP with recent failures, locked ones
+// first.
+func (g *Guard) Statuses() []Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.sweep(now)
+	statuses := []Status{}
+	for k, rec := range g.records {
+		status := Status{Kind: k.kind, Key: k.key, Failures: rec.failures, LastFailure: rec.lastFailure}
+		if now.Before(rec.lockedUntil) {
+			lockedUntil := rec.lockedUntil
+			status.LockedUntil = &lockedUntil
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if (statuses[i].LockedUntil != nil) != (statuses[j].LockedUntil != nil) {
+			return statuses[i].LockedUntil != nil
+		}
+		return statuses[i].LastFailure.After(statuses[j].LastFailure)
+	})
+	return statuses
+}
+
+func (g *Guard) fail(k key, limit int, now time.Time) {
+	rec := g.current(k, now)
+	if rec == nil {
+		rec = &record{}
+		g.records[k] = rec
+	}
+	rec.failures++
+	rec.lastFailure = now
+	g.onEvent(Event{Type: EventFailed, Kind: k.kind, Key: k.key, Failures: rec.failures, Time: now})
+
+	if limit > 0 && rec.failures >= limit {
+		rec.lockedUntil = now.Add(g.cfg.LockoutDuration)
+		g.onEvent(Event{Type: EventLocked, Kind: k.kind, Key: k.key, Failures: rec.failures, Time: now})
+		rec.failures = 0
+		return
+	}
+	rec.nextAllowed = now.Add(g.delay(rec.failures))
+}
+
+func (g *Guard) delay(failures int) time.Duration {
+	d := g.cfg.BaseDelay
+	for i := 1; i < failures && d < g.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, g.cfg.MaxDelay)
+}
+
+// current returns the record for k, forgetting it if it has gone stale.
+func (g *Guard) current(k key, now time.Time) *record {
+	rec, ok := g.records[k]
+	if !ok {
+		return nil
+	}
+	if g.stale(rec, now) {
+		delete(g.records, k)
+		return nil
+	}
+	return rec
+}
+
+func (g *Guard) stale(rec *record, now time.Time) bool {
+	return !now.Before(rec.lockedUntil) && now.Sub(rec.lastFailure) > g.cfg.Window
+}
+
+func (g *Guard) sweep(now time.Time) {
+	for k, rec := range g.records {
+		if g.stale(rec, now) {
+			delete(g.records, k)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func testConfig() Config {
+	return Config{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      5,
+		LockoutDuration:    10 * time.Minute,
+		BaseDelay:          time.Second,
+		MaxDelay:           4 * time.Second,
+		Window:             time.Hour,
+	}
+}
+
+func newTestGuard() (*Guard, *fakeClock, *[]Event) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	events := &[]Event{}
+	g := New(testConfig(), clock.Now, func(e Event) { *events = append(*events, e) })
+	return g, clock, events
+}
+
+func TestProgressiveDelay(t *testing.T) {
+	g, clock, _ := newTestGuard()
+
+	assert.True(t, g.Check("walt@breakingbad.com", "1.2.3.4").Allowed)
+	g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+
+	d := g.Check("walt@breakingbad.com", "1.2.3.4")
+	assert.False(t, d.Allowed)
+	assert.False(t, d.Locked)
+	assert.Equal(t, time.Second, d.RetryAfter)
+
+	clock.Advance(time.Second)
+	assert.True(t, g.Check("walt@breakingbad.com", "1.2.3.4").Allowed)
+	g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+	assert.Equal(t, 2*time.Second, g.Check("walt@breakingbad.com", "1.2.3.4").RetryAfter)
+}
+
+func TestAccountLockout(t *testing.T) {
+	g, clock, events := newTestGuard()
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Minute)
+		g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+	}
+
+	d := g.Check("walt@breakingbad.com", "5.6.7.8")
+	assert.False(t, d.Allowed)
+	assert.True(t, d.Locked)
+	assert.Equal(t, 10*time.Minute, d.RetryAfter)
+	assert.True(t, g.Check("jesse@breakingbad.com", "5.6.7.8").Allowed, "other accounts are unaffected")
+
+	statuses := g.Statuses()
+	assert.Equal(t, KindAccount, statuses[0].Kind)
+	assert.NotNil(t, statuses[0].LockedUntil)
+
+	var locked int
+	for _, e := range *events {
+		if e.Type == EventLocked {
+			locked++
+		}
+	}
+	assert.Equal(t, 1, locked)
+
+	clock.Advance(10 * time.Minute)
+	assert.True(t, g.Check("walt@breakingbad.com", "5.6.7.8").Allowed)
+}
+
+func TestIPLockoutAcrossAccounts(t *testing.T) {
+	g, clock, events := newTestGuard()
+
+	for _, account := range []string{"a", "b", "c", "d", "e"} {
+		clock.Advance(time.Minute)
+		g.RecordFailure(account, "1.2.3.4")
+	}
+
+	d := g.Check("f", "1.2.3.4")
+	assert.False(t, d.Allowed)
+	assert.True(t, d.Locked)
+	last := (*events)[len(*events)-1]
+	assert.Equal(t, EventThrottled, last.Type)
+	assert.Equal(t, KindIP, last.Kind, "the IP tripped, not the account")
+	assert.Equal(t, "1.2.3.4", last.Key)
+	assert.True(t, g.Check("f", "9.9.9.9").Allowed)
+}
+
+func TestSuccessResetsAccountOnly(t *testing.T) {
+	g, clock, _ := newTestGuard()
+
+	g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+	g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+	clock.Advance(time.Minute)
+	g.RecordSuccess("walt@breakingbad.com", "1.2.3.4")
+
+	g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+	clock.Advance(time.Minute)
+	assert.True(t, g.Check("walt@breakingbad.com", "1.2.3.4").Allowed, "account count restarted after success")
+
+	for _, s := range g.Statuses() {
+		if s.Kind == KindIP {
+			assert.Equal(t, 3, s.Failures)
+		}
+	}
+}
+
+func TestFailuresExpireAfterWindow(t *testing.T) {
+	g, clock, _ := newTestGuard()
+
+	g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+	g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+	clock.Advance(2 * time.Hour)
+	g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+	clock.Advance(time.Minute)
+
+	assert.True(t, g.Check("walt@breakingbad.com", "1.2.3.4").Allowed)
+	assert.Len(t, g.Statuses(), 2)
+}
+
+func TestUnlock(t *testing.T) {
+	g, _, events := newTestGuard()
+
+	for i := 0; i < 3; i++ {
+		g.RecordFailure("walt@breakingbad.com", "1.2.3.4")
+	}
+	assert.True(t, g.Unlock(KindAccount, "walt@breakingbad.com"))
+	assert.False(t, g.Unlock(KindAccount, "walt@breakingbad.com"))
+	assert.Equal(t, EventUnlocked, (*events)[len(*events)-1].Type)
+}
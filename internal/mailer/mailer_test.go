@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "no-reply@chirpy.local"}
+
+	err := m.Send(context.Background(), Message{
+		To:      "walt@breakingbad.com",
+		Subject: "Verify your email",
+		Body:    "token: abc",
+	})
+	if err != nil {
+		t.Fatal("couldn't send mail")
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatal("expected one message on disk")
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal("couldn't read message")
+	}
+	assert.Contains(t, string(data), "To: walt@breakingbad.com\r\n")
+	assert.Contains(t, string(data), "Subject: Verify your email\r\n")
+	assert.Contains(t, string(data), "token: abc")
+}
+
+func TestFromEnvFileMailerOnlyInDev(t *testing.T) {
+	t.Setenv("MAILER", "")
+
+	_, err := FromEnv(false)
+	assert.Error(t, err)
+
+	m, err := FromEnv(true)
+	assert.NoError(t, err)
+	assert.IsType(t, &FileMailer{}, m)
+}
@@ -0,0 +1,33 @@
+// Package mergepatch helps decode JSON merge patches (RFC 7396), where a
+// member that is left out means "keep the current value" and a member set
+// to null means "remove it".
+package mergepatch
+
+import "encoding/json"
+
+// ContentType is the media type of a JSON merge patch.
+const ContentType = "application/merge-patch+json"
+
+// Field is one member of a patch document. Its zero value means the member
+// was absent.
+type Field[T any] struct {
+	// Set reports whether the member appeared in the patch at all.
+	Set bool
+	// Null reports whether it appeared as null.
+	Null  bool
+	Value T
+}
+
+// UnmarshalJSON is only called for members present in the document,
+// including those set to null.
+func (f *Field[T]) UnmarshalJSON(data []byte) error {
+	f.Set = true
+	if string(data) == "null" {
+		f.Null = true
+		var zero T
+		f.Value = zero
+		return nil
+	}
+	f.Null = false
+	return json.Unmarshal(data, &f.Value)
+}
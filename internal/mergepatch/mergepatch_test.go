@@ -0,0 +1,26 @@
+package mergepatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestField(t *testing.T) {
+	type patch struct {
+		Name Field[string] `json:"name"`
+		Bio  Field[string] `json:"bio"`
+		Age  Field[int]    `json:"age"`
+	}
+
+	var p patch
+	err := json.Unmarshal([]byte(`{"name": "Saul", "bio": null}`), &p)
+	assert.NoError(t, err)
+	assert.Equal(t, Field[string]{Set: true, Value: "Saul"}, p.Name)
+	assert.Equal(t, Field[string]{Set: true, Null: true}, p.Bio)
+	assert.False(t, p.Age.Set)
+
+	err = json.Unmarshal([]byte(`{"age": "old"}`), &p)
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package oauth
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/hconn7/Chirpy/internal/auth"
+)
+
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:  "Read chirps",
+	auth.ScopeChirpsWrite: "Post and delete chirps as you",
+}
+
+var consentPage = template.Must(template.New("consent").Funcs(template.FuncMap{
+	"describe": func(scope string) string {
+		if desc, ok := scopeDescriptions[scope]; ok {
+			return desc
+		}
+		return scope
+	},
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>Authorize {{.Client.Name}} - Chirpy</title></head>
+<body>
+<h1>{{.Client.Name}} wants to use your Chirpy account</h1>
+<p>It will be able to:</p>
+<ul>
+{{range .Scopes}}<li>{{describe .}}</li>
+{{end}}</ul>
+{{if .Message}}<p role="alert">{{.Message}}</p>{{end}}
+<form method="post">
+<input type="hidden" name="response_type" value="code">
+<input type="hidden" name="client_id" value="{{.Client.ID}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="scope" value="{{join .Scopes " "}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="S256">
+<label>Email <input type="email" name="email" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<label>Two-factor code, if enabled <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code"></label>
+<button type="submit" name="decision" value="approve">Allow</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+</form>
+</body>
+</html>
+`))
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Authorization failed - Chirpy</title></head>
+<body>
+<h1>Authorization failed</h1>
+<p>{{.Description}}</p>
+</body>
+</html>
+`))
+
+// setPageHeaders stops the consent page from being framed, so another site
+// can't trick a user into clicking Allow.
+func setPageHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+}
+
+func renderConsent(w http.ResponseWriter, code int, req authorizeRequest, message string) {
+	setPageHeaders(w)
+	w.WriteHeader(code)
+	data := struct {
+		authorizeRequest
+		Message string
+	}{req, message}
+	if err := consentPage.Execute(w, data); err != nil {
+		log.Printf("Error rendering consent page: %v", err)
+	}
+}
+
+func renderError(w http.ResponseWriter, oauthErr *Error) {
+	setPageHeaders(w)
+	w.WriteHeader(oauthErr.status)
+	if err := errorPage.Execute(w, oauthErr); err != nil {
+		log.Printf("Error rendering OAuth error page: %v", err)
+	}
+}
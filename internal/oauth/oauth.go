@@ -0,0 +1,124 @@
+// Package oauth implements the OAuth 2 authorization code flow with PKCE so
+// third-party apps can act for Chirpy users without seeing their passwords.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+)
+
+// ErrNotFound is returned by a Store when a client, code or refresh token
+// doesn't exist or can no longer be used.
+var ErrNotFound = errors.New("Not found")
+
+// Client is an app registered to use the authorization flow.
+type Client struct {
+	ID   uuid.UUID
+	Name string
+	// SecretHash is empty for public clients, which can't keep a secret and
+	// rely on PKCE alone.
+	SecretHash   string
+	RedirectURIs []string
+	Scopes       []string
+	Revoked      bool
+}
+
+func (c Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+func (c Client) checkSecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(c.SecretHash)) == 1
+}
+
+// AuthorizationCode is a grant waiting to be exchanged at the token endpoint.
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+type RefreshToken struct {
+	TokenHash string
+	ClientID  uuid.UUID
+	UserID    uuid.UUID
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// Store persists clients and grants. Codes and refresh tokens are looked up
+// by the hash of their value and the Use methods must consume them
+// atomically so each can only be exchanged once.
+type Store interface {
+	GetClient(ctx context.Context, id uuid.UUID) (Client, error)
+	CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error
+	UseAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error)
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	UseRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+}
+
+// NewClientSecret returns a random secret for a confidential client. Only
+// auth.HashToken of it should be stored.
+func NewClientSecret() (string, error) {
+	return newToken()
+}
+
+func newToken() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", errors.New("Couldn't make token")
+	}
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge for a verifier as in
+// RFC 7636.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(CodeChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// ValidRedirectURI checks a redirect URI at registration. Codes must only
+// travel over https, except to a loopback address for native apps.
+func ValidRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return errors.New("Redirect URI must be an absolute URL")
+	}
+	if u.Fragment != "" {
+		return errors.New("Redirect URI can't have a fragment")
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if u.Hostname() == "localhost" {
+			return nil
+		}
+		if ip := net.ParseIP(u.Hostname()); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+	}
+	return errors.New("Redirect URI must use https")
+}
@@ -0,0 +1,335 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+)
+
+// Server serves /oauth/authorize and /oauth/token.
+type Server struct {
+	store Store
+	keys  *auth.KeySet
+	// authenticate logs the user in from the consent form. Its error
+	// message is shown on the page, so it must not say which part of the
+	// login was wrong.
+	authenticate func(r *http.Request) (uuid.UUID, error)
+	now          func() time.Time
+
+	CodeTTL         time.Duration
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+func NewServer(store Store, keys *auth.KeySet, authenticate func(r *http.Request) (uuid.UUID, error)) *Server {
+	return &Server{
+		store:           store,
+		keys:            keys,
+		authenticate:    authenticate,
+		now:             time.Now,
+		CodeTTL:         time.Minute,
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 30 * 24 * time.Hour,
+	}
+}
+
+// Error is an OAuth error response as in RFC 6749 section 5.2.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	status      int
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newError(status int, code, description string) *Error {
+	return &Error{Code: code, Description: description, status: status}
+}
+
+type authorizeRequest struct {
+	Client        Client
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+}
+
+// parseAuthorizeRequest validates the query of an authorization request, or
+// the hidden fields of the consent form. Until the client and redirect URI
+// are known to be good, errors must be shown to the user rather than sent
+// to the redirect URI, otherwise the endpoint would be an open redirector.
+func (s *Server) parseAuthorizeRequest(r *http.Request) (req authorizeRequest, redirectable bool, err *Error) {
+	clientID, parseErr := uuid.Parse(r.FormValue("client_id"))
+	if parseErr != nil {
+		return req, false, newError(400, "invalid_request", "Missing or malformed client_id")
+	}
+	client, getErr := s.store.GetClient(r.Context(), clientID)
+	if getErr != nil || client.Revoked {
+		return req, false, newError(400, "invalid_client", "Unknown client")
+	}
+	req.Client = client
+
+	req.RedirectURI = r.FormValue("redirect_uri")
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return req, false, newError(400, "invalid_request", "redirect_uri is not registered for this client")
+	}
+	req.State = r.FormValue("state")
+
+	if r.FormValue("response_type") != "code" {
+		return req, true, newError(400, "unsupported_response_type", "Only the code response type is supported")
+	}
+	req.CodeChallenge = r.FormValue("code_challenge")
+	if req.CodeChallenge == "" || r.FormValue("code_challenge_method") != "S256" {
+		return req, true, newError(400, "invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+
+	req.Scopes = strings.Fields(r.FormValue("scope"))
+	if len(req.Scopes) == 0 {
+		req.Scopes = client.Scopes
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return req, true, newError(400, "invalid_scope", "Scope not allowed for this client: "+scope)
+		}
+	}
+	return req, true, nil
+}
+
+// redirect sends the user agent back to the client with the given
+// parameters plus the client's state.
+func (req authorizeRequest) redirect(w http.ResponseWriter, r *http.Request, params url.Values) {
+	target, _ := url.Parse(req.RedirectURI)
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (req authorizeRequest) redirectError(w http.ResponseWriter, r *http.Request, err *Error) {
+	req.redirect(w, r, url.Values{"error": {err.Code}, "error_description": {err.Description}})
+}
+
+// HandleAuthorize shows the consent page on GET. On POST it logs the user in
+// from the form and, if they approved, redirects back to the client with an
+// authorization code.
+func (s *Server) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, redirectable, oauthErr := s.parseAuthorizeRequest(r)
+	if oauthErr != nil {
+		if redirectable {
+			req.redirectError(w, r, oauthErr)
+			return
+		}
+		renderError(w, oauthErr)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		renderConsent(w, 200, req, "")
+		return
+	}
+
+	if r.PostFormValue("decision") != "approve" {
+		req.redirectError(w, r, newError(403, "access_denied", "The user denied the request"))
+		return
+	}
+	userID, err := s.authenticate(r)
+	if err != nil {
+		renderConsent(w, 401, req, err.Error())
+		return
+	}
+
+	code, err := newToken()
+	if err != nil {
+		renderError(w, newError(500, "server_error", "Couldn't make authorization code"))
+		return
+	}
+	if err := s.store.CreateAuthorizationCode(r.Context(), AuthorizationCode{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.Client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     s.now().Add(s.CodeTTL),
+	}); err != nil {
+		log.Printf("Couldn't save authorization code: %v", err)
+		renderError(w, newError(500, "server_error", "Couldn't save authorization code"))
+		return
+	}
+	req.redirect(w, r, url.Values{"code": {code}})
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// HandleToken exchanges an authorization code or refresh token for a new
+// access token and refresh token. Refresh tokens are rotated on every use.
+func (s *Server) HandleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError(400, "invalid_request", "Couldn't parse form"))
+		return
+	}
+	client, oauthErr := s.authenticateClient(r)
+	if oauthErr != nil {
+		writeError(w, oauthErr)
+		return
+	}
+
+	var grant RefreshToken
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		grant, oauthErr = s.exchangeCode(r, client)
+	case "refresh_token":
+		grant, oauthErr = s.exchangeRefreshToken(r, client)
+	default:
+		oauthErr = newError(400, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	}
+	if oauthErr != nil {
+		writeError(w, oauthErr)
+		return
+	}
+
+	resp, oauthErr := s.issue(r, grant)
+	if oauthErr != nil {
+		writeError(w, oauthErr)
+		return
+	}
+	writeJSON(w, 200, resp)
+}
+
+// authenticateClient reads client credentials from HTTP Basic auth or the
+// form body. Public clients only send their client_id.
+func (s *Server) authenticateClient(r *http.Request) (Client, *Error) {
+	rawID, secret, basic := r.BasicAuth()
+	if !basic {
+		rawID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	invalid := newError(401, "invalid_client", "Client authentication failed")
+
+	clientID, err := uuid.Parse(rawID)
+	if err != nil {
+		return Client{}, invalid
+	}
+	client, err := s.store.GetClient(r.Context(), clientID)
+	if err != nil || client.Revoked {
+		return Client{}, invalid
+	}
+	if !client.Public() && !client.checkSecret(secret) {
+		return Client{}, invalid
+	}
+	return client, nil
+}
+
+func (s *Server) exchangeCode(r *http.Request, client Client) (RefreshToken, *Error) {
+	invalid := newError(400, "invalid_grant", "Authorization code is invalid, expired or already used")
+
+	code, err := s.store.UseAuthorizationCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if errors.Is(err, ErrNotFound) {
+		return RefreshToken{}, invalid
+	}
+	if err != nil {
+		return RefreshToken{}, newError(500, "server_error", "Couldn't look up authorization code")
+	}
+	if code.ClientID != client.ID || s.now().After(code.ExpiresAt) {
+		return RefreshToken{}, invalid
+	}
+	if r.PostForm.Get("redirect_uri") != code.RedirectURI {
+		return RefreshToken{}, newError(400, "invalid_grant", "redirect_uri doesn't match the authorization request")
+	}
+	if !verifyCodeChallenge(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		return RefreshToken{}, newError(400, "invalid_grant", "code_verifier doesn't match the code challenge")
+	}
+	return RefreshToken{ClientID: client.ID, UserID: code.UserID, Scopes: code.Scopes}, nil
+}
+
+func (s *Server) exchangeRefreshToken(r *http.Request, client Client) (RefreshToken, *Error) {
+	invalid := newError(400, "invalid_grant", "Refresh token is invalid, expired or revoked")
+
+	token, err := s.store.UseRefreshToken(r.Context(), auth.HashToken(r.PostForm.Get("refresh_token")))
+	if errors.Is(err, ErrNotFound) {
+		return RefreshToken{}, invalid
+	}
+	if err != nil {
+		return RefreshToken{}, newError(500, "server_error", "Couldn't look up refresh token")
+	}
+	if token.ClientID != client.ID || s.now().After(token.ExpiresAt) {
+		return RefreshToken{}, invalid
+	}
+
+	// A client may ask for fewer scopes than it was granted, never more.
+	if requested := strings.Fields(r.PostForm.Get("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(token.Scopes, scope) {
+				return RefreshToken{}, newError(400, "invalid_scope", "Scope was not granted: "+scope)
+			}
+		}
+		token.Scopes = requested
+	}
+	return token, nil
+}
+
+func (s *Server) issue(r *http.Request, grant RefreshToken) (tokenResponse, *Error) {
+	accessToken, err := s.keys.MakeClientJWT(grant.UserID, grant.ClientID.String(), grant.Scopes, s.AccessTokenTTL)
+	if err != nil {
+		return tokenResponse{}, newError(500, "server_error", "Couldn't make access token")
+	}
+	refreshToken, err := newToken()
+	if err != nil {
+		return tokenResponse{}, newError(500, "server_error", "Couldn't make refresh token")
+	}
+	if err := s.store.CreateRefreshToken(r.Context(), RefreshToken{
+		TokenHash: auth.HashToken(refreshToken),
+		ClientID:  grant.ClientID,
+		UserID:    grant.UserID,
+		Scopes:    grant.Scopes,
+		ExpiresAt: s.now().Add(s.RefreshTokenTTL),
+	}); err != nil {
+		log.Printf("Couldn't save OAuth refresh token: %v", err)
+		return tokenResponse{}, newError(500, "server_error", "Couldn't save refresh token")
+	}
+
+	return tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(grant.Scopes, " "),
+	}, nil
+}
+
+func writeError(w http.ResponseWriter, err *Error) {
+	if err.status == 401 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	writeJSON(w, err.status, err)
+}
+
+// writeJSON sends a token endpoint response, which must never be cached.
+func writeJSON(w http.ResponseWriter, code int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		log.Printf("Error encoding OAuth response: %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+type memStore struct {
+	mu      sync.Mutex
+	clients map[uuid.UUID]Client
+	codes   map[string]AuthorizationCode
+	tokens  map[string]RefreshToken
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		clients: map[uuid.UUID]Client{},
+		codes:   map[string]AuthorizationCode{},
+		tokens:  map[string]RefreshToken{},
+	}
+}
+
+func (m *memStore) GetClient(ctx context.Context, id uuid.UUID) (Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.clients[id]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (m *memStore) CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code.CodeHash] = code
+	return nil
+}
+
+func (m *memStore) UseAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.codes[codeHash]
+	if !ok {
+		return AuthorizationCode{}, ErrNotFound
+	}
+	delete(m.codes, codeHash)
+	return code, nil
+}
+
+func (m *memStore) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *memStore) UseRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[tokenHash]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	delete(m.tokens, tokenHash)
+	return token, nil
+}
+
+const (
+	redirectURI = "https://partner.example/callback"
+	verifier    = "dBjftJeZ4CVP-mJ92K1cKWZcg0L6o3OPS9qQ6Rx4Ni0xq8"
+)
+
+type testEnv struct {
+	srv    *httptest.Server
+	http   *http.Client
+	store  *memStore
+	keys   *auth.KeySet
+	userID uuid.UUID
+	client Client
+	secret string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	env := &testEnv{
+		store:  newMemStore(),
+		keys:   auth.NewKeySet(auth.NewHMACKey("test-secret")),
+		userID: uuid.New(),
+		secret: "partner-secret",
+	}
+	env.client = Client{
+		ID:           uuid.New(),
+		Name:         "Partner App",
+		SecretHash:   auth.HashToken(env.secret),
+		RedirectURIs: []string{redirectURI},
+		Scopes:       []string{auth.ScopeChirpsRead, auth.ScopeChirpsWrite},
+	}
+	env.store.clients[env.client.ID] = env.client
+
+	server := NewServer(env.store, env.keys, func(r *http.Request) (uuid.UUID, error) {
+		if r.PostFormValue("email") != "walt@breakingbad.com" || r.PostFormValue("password") != "heisenberg" {
+			return uuid.Nil, errors.New("Email, password or code is incorrect")
+		}
+		return env.userID, nil
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /oauth/authorize", server.HandleAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", server.HandleAuthorize)
+	mux.HandleFunc("POST /oauth/token", server.HandleToken)
+	env.srv = httptest.NewServer(mux)
+	t.Cleanup(env.srv.Close)
+
+	env.http = env.srv.Client()
+	env.http.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return env
+}
+
+func (env *testEnv) authorizeParams() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {env.client.ID.String()},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {auth.ScopeChirpsRead},
+		"state":                 {"xyz"},
+		"code_challenge":        {CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// approve submits the consent form and returns the redirect location.
+func (env *testEnv) approve(t *testing.T, params url.Values) *url.URL {
+	params.Set("email", "walt@breakingbad.com")
+	params.Set("password", "heisenberg")
+	params.Set("decision", "approve")
+	resp, err := env.http.PostForm(env.srv.URL+"/oauth/authorize", params)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	return location
+}
+
+func (env *testEnv) token(t *testing.T, form url.Values) (int, map[string]any) {
+	req, _ := http.NewRequest("POST", env.srv.URL+"/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(env.client.ID.String(), env.secret)
+	resp, err := env.http.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body := map[string]any{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp, err := env.http.Get(env.srv.URL + "/oauth/authorize?" + env.authorizeParams().Encode())
+	assert.NoError(t, err)
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"))
+	assert.Contains(t, string(page), "Partner App wants to use your Chirpy account")
+	assert.Contains(t, string(page), "Read chirps")
+
+	location := env.approve(t, env.authorizeParams())
+	assert.Equal(t, "partner.example", location.Host)
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	code := location.Query().Get("code")
+	assert.NotEmpty(t, code)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+	status, tokens := env.token(t, exchange)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "Bearer", tokens["token_type"])
+	assert.Equal(t, auth.ScopeChirpsRead, tokens["scope"])
+
+	claims, err := env.keys.ParseJWT(tokens["access_token"].(string), auth.DefaultAudience)
+	assert.NoError(t, err)
+	assert.Equal(t, env.userID, claims.UserID)
+	assert.Equal(t, env.client.ID.String(), claims.ClientID)
+	assert.Equal(t, []string{auth.ScopeChirpsRead}, claims.Scopes)
+
+	// Codes are single use.
+	status, body := env.token(t, exchange)
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+
+	// Refresh tokens rotate, so the old one stops working.
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens["refresh_token"].(string)}}
+	status, rotated := env.token(t, refresh)
+	assert.Equal(t, 200, status)
+	assert.NotEqual(t, tokens["refresh_token"], rotated["refresh_token"])
+	status, body = env.token(t, refresh)
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+}
+
+func TestTokenRequiresMatchingVerifier(t *testing.T) {
+	env := newTestEnv(t)
+	location := env.approve(t, env.authorizeParams())
+
+	status, body := env.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {strings.Repeat("a", 43)},
+	})
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+}
+
+func TestAuthorizeRejectsUnregisteredRedirect(t *testing.T) {
+	env := newTestEnv(t)
+	params := env.authorizeParams()
+	params.Set("redirect_uri", "https://evil.example/callback")
+
+	resp, err := env.http.Get(env.srv.URL + "/oauth/authorize?" + params.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Location"))
+}
+
+func TestAuthorizeRedirectsErrors(t *testing.T) {
+	env := newTestEnv(t)
+
+	params := env.authorizeParams()
+	params.Del("code_challenge")
+	resp, err := env.http.Get(env.srv.URL + "/oauth/authorize?" + params.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	assert.Equal(t, "invalid_request", location.Query().Get("error"))
+
+	params = env.authorizeParams()
+	params.Set("scope", auth.ScopeUserWrite)
+	resp, err = env.http.Get(env.srv.URL + "/oauth/authorize?" + params.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	location, _ = url.Parse(resp.Header.Get("Location"))
+	assert.Equal(t, "invalid_scope", location.Query().Get("error"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+
+	params = env.authorizeParams()
+	params.Set("decision", "deny")
+	resp, err = env.http.PostForm(env.srv.URL+"/oauth/authorize", params)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	location, _ = url.Parse(resp.Header.Get("Location"))
+	assert.Equal(t, "access_denied", location.Query().Get("error"))
+}
+
+func TestAuthorizeWrongPasswordShowsForm(t *testing.T) {
+	env := newTestEnv(t)
+	params := env.authorizeParams()
+	params.Set("email", "walt@breakingbad.com")
+	params.Set("password", "wrong")
+	params.Set("decision", "approve")
+
+	resp, err := env.http.PostForm(env.srv.URL+"/oauth/authorize", params)
+	assert.NoError(t, err)
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+	assert.Contains(t, string(page), "Email, password or code is incorrect")
+	assert.Empty(t, env.store.codes)
+}
+
+func TestRevokedClientCantExchange(t *testing.T) {
+	env := newTestEnv(t)
+	location := env.approve(t, env.authorizeParams())
+
+	client := env.client
+	client.Revoked = true
+	env.store.clients[client.ID] = client
+
+	status, body := env.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+	assert.Equal(t, 401, status)
+	assert.Equal(t, "invalid_client", body["error"])
+}
+
+func TestExpiredCode(t *testing.T) {
+	env := newTestEnv(t)
+	location := env.approve(t, env.authorizeParams())
+	for hash, code := range env.store.codes {
+		code.ExpiresAt = time.Now().Add(-time.Second)
+		env.store.codes[hash] = code
+	}
+
+	status, body := env.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	assert.NoError(t, ValidRedirectURI("https://partner.example/callback"))
+	assert.NoError(t, ValidRedirectURI("http://localhost:3000/callback"))
+	assert.NoError(t, ValidRedirectURI("http://127.0.0.1:8000/cb"))
+	assert.Error(t, ValidRedirectURI("http://partner.example/callback"))
+	assert.Error(t, ValidRedirectURI("https://partner.example/callback#frag"))
+	assert.Error(t, ValidRedirectURI("/callback"))
+}
@@ -0,0 +1,335 @@
+// Package oidc signs users in through an external OpenID Connect provider
+// using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config names a provider and the credentials Chirpy is registered with.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes defaults to openid, email and profile.
+	Scopes []string
+}
+
+// Identity is what a validated ID token says about the user.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// jwksRefreshInterval limits how often an unknown kid can make us refetch
+// the provider's keys.
+const jwksRefreshInterval = time.Minute
+
+// Client talks to one provider. Discovery happens on first use and the
+// provider's signing keys are cached until a token names a key we don't have.
+type Client struct {
+	config Config
+	http   *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	provider    *discovery
+	keys        map[string]any
+	keysFetched time.Time
+}
+
+func NewClient(config Config, httpClient *http.Client) *Client {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{config: config, http: httpClient, now: time.Now}
+}
+
+func (c *Client) Issuer() string {
+	return c.config.Issuer
+}
+
+func (c *Client) discover(ctx context.Context) (*discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider != nil {
+		return c.provider, nil
+	}
+
+	var provider discovery
+	wellKnown := strings.TrimSuffix(c.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := c.getJSON(ctx, wellKnown, &provider); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	// The document must be about the issuer we asked for, otherwise one
+	// provider could vouch for users of another.
+	if provider.Issuer != c.config.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q doesn't match %q", provider.Issuer, c.config.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, errors.New("discovery: document is missing endpoints")
+	}
+	c.provider = &provider
+	return c.provider, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, target string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// LoginState is kept by the user agent between redirecting to the provider
+// and the callback. State protects against CSRF, the nonce binds the ID
+// token to this login and the verifier is the PKCE secret.
+type LoginState struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func NewLoginState() (LoginState, error) {
+	var values [3]string
+	for i := range values {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return LoginState{}, errors.New("Couldn't make login state")
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(key)
+	}
+	return LoginState{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// Encode packs the state into a cookie-safe string.
+func (s LoginState) Encode() string {
+	return s.State + "." + s.Nonce + "." + s.Verifier
+}
+
+func DecodeLoginState(encoded string) (LoginState, error) {
+	parts := strings.Split(encoded, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return LoginState{}, errors.New("Malformed login state")
+	}
+	return LoginState{State: parts[0], Nonce: parts[1], Verifier: parts[2]}, nil
+}
+
+// AuthCodeURL is where to send the user to sign in at the provider.
+func (c *Client) AuthCodeURL(ctx context.Context, state LoginState) (string, error) {
+	provider, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	target, err := url.Parse(provider.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.config.ClientID)
+	query.Set("redirect_uri", c.config.RedirectURL)
+	query.Set("scope", strings.Join(c.config.Scopes, " "))
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// Exchange redeems the code from the callback and returns the identity from
+// the validated ID token.
+func (c *Client) Exchange(ctx context.Context, code string, state LoginState) (Identity, error) {
+	provider, err := c.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.config.RedirectURL},
+		"code_verifier": {state.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Identity{}, fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return Identity{}, fmt.Errorf("token endpoint: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return Identity{}, errors.New("token response has no id_token")
+	}
+	return c.VerifyIDToken(ctx, body.IDToken, state.Nonce)
+}
+
+// flexBool accepts "true" as well as true, since some providers send
+// email_verified as a string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string   `json:"nonce"`
+	AuthorizedParty string   `json:"azp"`
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// VerifyIDToken checks the signature against the provider's JWKS along with
+// issuer, audience, expiry and nonce as in OpenID Connect Core 3.1.3.7.
+func (c *Client) VerifyIDToken(ctx context.Context, raw, nonce string) (Identity, error) {
+	provider, err := c.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims,
+		func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			return c.key(ctx, provider, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(c.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithTimeFunc(c.now),
+	)
+	if err != nil {
+		return Identity{}, err
+	}
+	if claims.Nonce != nonce {
+		return Identity{}, errors.New("ID token nonce doesn't match")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != c.config.ClientID {
+		return Identity{}, errors.New("ID token was issued to another client")
+	}
+	if claims.Subject == "" {
+		return Identity{}, errors.New("ID token has no subject")
+	}
+
+	return Identity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// key returns the provider's public key with the given kid. An unknown kid
+// usually means the provider rotated its keys, so the JWKS is fetched again.
+func (c *Client) key(ctx context.Context, provider *discovery, kid string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+	if c.keys != nil && c.now().Sub(c.keysFetched) < jwksRefreshInterval {
+		return nil, errors.New("Unknown signing key")
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := c.getJSON(ctx, provider.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	c.keys = map[string]any{}
+	c.keysFetched = c.now()
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		public, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		c.keys[k.Kid] = public
+	}
+
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, errors.New("Unknown signing key")
+}
+
+// lookupKey finds a cached key. A token without a kid is only accepted when
+// the provider publishes exactly one key.
+func (c *Client) lookupKey(kid string) (any, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
@@ -0,0 +1,256 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	clientID     = "chirpy"
+	clientSecret = "s3cret"
+	redirectURL  = "https://chirpy.example/api/login/oidc/test/callback"
+)
+
+type pendingCode struct {
+	nonce     string
+	challenge string
+}
+
+// fakeProvider is a minimal OpenID Connect provider. authorize stands in for
+// the user signing in and returns the code the browser would bring back.
+type fakeProvider struct {
+	srv    *httptest.Server
+	issuer string
+
+	mu          sync.Mutex
+	key         *rsa.PrivateKey
+	kid         string
+	codes       map[string]pendingCode
+	claims      jwt.MapClaims
+	jwksFetches int
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	p := &fakeProvider{codes: map[string]pendingCode{}}
+	p.rotateKey(t, "key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.issuer,
+			"authorization_endpoint": p.issuer + "/authorize",
+			"token_endpoint":         p.issuer + "/token",
+			"jwks_uri":               p.issuer + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.jwksFetches++
+		pub := p.key.PublicKey
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", p.handleToken)
+	p.srv = httptest.NewServer(mux)
+	p.issuer = p.srv.URL
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+func (p *fakeProvider) rotateKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key, p.kid = key, kid
+}
+
+func (p *fakeProvider) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, clientID, q.Get("client_id"))
+	assert.Equal(t, redirectURL, q.Get("redirect_uri"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code := "code-" + q.Get("state")
+	p.codes[code] = pendingCode{nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	return code
+}
+
+func (p *fakeProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != clientID || secret != clientSecret {
+		w.WriteHeader(401)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pending, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != pending.challenge {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            "user-123",
+		"aud":            clientID,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          pending.nonce,
+		"email":          "jesse@breakingbad.com",
+		"email_verified": true,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+	signed, _ := token.SignedString(p.key)
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "access_token": "opaque", "token_type": "Bearer"})
+}
+
+func (p *fakeProvider) client() *Client {
+	return NewClient(Config{
+		Issuer:       p.issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}, p.srv.Client())
+}
+
+// login runs the whole flow against the fake provider.
+func login(t *testing.T, p *fakeProvider, c *Client) (Identity, error) {
+	state, err := NewLoginState()
+	assert.NoError(t, err)
+	authURL, err := c.AuthCodeURL(context.Background(), state)
+	assert.NoError(t, err)
+	code := p.authorize(t, authURL)
+	return c.Exchange(context.Background(), code, state)
+}
+
+func TestLogin(t *testing.T) {
+	p := newFakeProvider(t)
+
+	identity, err := login(t, p, p.client())
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{
+		Issuer:        p.issuer,
+		Subject:       "user-123",
+		Email:         "jesse@breakingbad.com",
+		EmailVerified: true,
+	}, identity)
+}
+
+func TestEmailVerifiedAsString(t *testing.T) {
+	p := newFakeProvider(t)
+	p.claims = jwt.MapClaims{"email_verified": "true"}
+
+	identity, err := login(t, p, p.client())
+	assert.NoError(t, err)
+	assert.True(t, identity.EmailVerified)
+}
+
+func TestRejectsBadIDTokens(t *testing.T) {
+	cases := map[string]jwt.MapClaims{
+		"wrong audience": {"aud": "someone-else"},
+		"wrong issuer":   {"iss": "https://evil.example"},
+		"expired":        {"exp": time.Now().Add(-time.Hour).Unix()},
+		"wrong nonce":    {"nonce": "replayed"},
+		"other azp":      {"aud": []string{clientID, "other"}, "azp": "other"},
+	}
+	for name, claims := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := newFakeProvider(t)
+			p.claims = claims
+			_, err := login(t, p, p.client())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExchangeNeedsVerifier(t *testing.T) {
+	p := newFakeProvider(t)
+	c := p.client()
+
+	state, _ := NewLoginState()
+	authURL, err := c.AuthCodeURL(context.Background(), state)
+	assert.NoError(t, err)
+	code := p.authorize(t, authURL)
+
+	other, _ := NewLoginState()
+	state.Verifier = other.Verifier
+	_, err = c.Exchange(context.Background(), code, state)
+	assert.ErrorContains(t, err, "invalid_grant")
+}
+
+func TestKeyRotation(t *testing.T) {
+	p := newFakeProvider(t)
+	c := p.client()
+	clock := time.Now()
+	c.now = func() time.Time { return clock }
+
+	_, err := login(t, p, c)
+	assert.NoError(t, err)
+	_, err = login(t, p, c)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.jwksFetches)
+
+	// A new kid is fetched once the refresh interval has passed.
+	p.rotateKey(t, "key-2")
+	_, err = login(t, p, c)
+	assert.Error(t, err)
+	clock = clock.Add(jwksRefreshInterval)
+	_, err = login(t, p, c)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, p.jwksFetches)
+}
+
+func TestDiscoveryChecksIssuer(t *testing.T) {
+	p := newFakeProvider(t)
+	c := NewClient(Config{Issuer: p.issuer + "/", ClientID: clientID}, p.srv.Client())
+
+	_, err := c.AuthCodeURL(context.Background(), LoginState{})
+	assert.ErrorContains(t, err, "doesn't match")
+}
+
+func TestLoginStateRoundTrip(t *testing.T) {
+	state, err := NewLoginState()
+	assert.NoError(t, err)
+
+	decoded, err := DecodeLoginState(state.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, state, decoded)
+
+	_, err = DecodeLoginState("only.two")
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+package pubsub
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPending bounds how many skipped IDs a Cursor waits for. Gaps wider
+// than that only keep the IDs just below the new one.
+const maxPending = 100
+
+// Cursor tracks how far a reader has got through events numbered by a
+// database sequence. A sequence value is taken when a row is inserted but
+// only becomes visible when it commits, so a higher ID can be read before a
+// lower one. A Cursor remembers the IDs it skipped over, so they are still
+// accepted when they show up, until Expire gives up on them.
+//
+// A zero Cursor starts at the first ID it accepts. It is not safe for
+// concurrent use.
+type Cursor struct {
+	last    int64
+	pending map[int64]time.Time
+}
+
+// NewCursor returns a Cursor that has seen every ID up to last.
+func NewCursor(last int64) *Cursor {
+	return &Cursor{last: last}
+}
+
+// ParseCursor decodes a Cursor encoded with String.
+func ParseCursor(s string, now time.Time) (*Cursor, error) {
+	lastStr, pendingStr, _ := strings.Cut(s, ":")
+	last, err := strconv.ParseInt(lastStr, 10, 64)
+	if err != nil || last < 0 {
+		return nil, errors.New("pubsub: invalid cursor")
+	}
+	c := NewCursor(last)
+	if pendingStr == "" {
+		return c, nil
+	}
+	ids := strings.Split(pendingStr, ",")
+	if len(ids) > maxPending {
+		return nil, errors.New("pubsub: invalid cursor")
+	}
+	c.pending = map[int64]time.Time{}
+	for _, s := range ids {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id <= 0 || id >= last {
+			return nil, errors.New("pubsub: invalid cursor")
+		}
+		c.pending[id] = now
+	}
+	return c, nil
+}
+
+// Last returns the highest ID accepted.
+func (c *Cursor) Last() int64 {
+	return c.last
+}
+
+// From returns the ID to read after to get both new IDs and skipped ones
+// that may have committed since.
+func (c *Cursor) From() int64 {
+	from := c.last
+	for id := range c.pending {
+		if id-1 < from {
+			from = id - 1
+		}
+	}
+	return from
+}
+
+// Accept records id and reports whether it is new to the reader.
+func (c *Cursor) Accept(id int64, now time.Time) bool {
+	if c.last == 0 && len(c.pending) == 0 {
+		c.last = id
+		return true
+	}
+	if id > c.last {
+		if c.pending == nil {
+			c.pending = map[int64]time.Time{}
+		}
+		for skipped := max(c.last+1, id-maxPending); skipped < id; skipped++ {
+			c.pending[skipped] = now
+		}
+		for len(c.pending) > maxPending {
+			delete(c.pending, c.oldestPending())
+		}
+		c.last = id
+		return true
+	}
+	if _, ok := c.pending[id]; ok {
+		delete(c.pending, id)
+		return true
+	}
+	return false
+}
+
+func (c *Cursor) oldestPending() int64 {
+	oldest := c.last
+	for id := range c.pending {
+		oldest = min(oldest, id)
+	}
+	return oldest
+}
+
+// Expire stops waiting for IDs skipped more than maxAge ago. Their inserts
+// were rolled back, or are taking so long they are treated as lost.
+func (c *Cursor) Expire(now time.Time, maxAge time.Duration) {
+	for id, skippedAt := range c.pending {
+		if now.Sub(skippedAt) > maxAge {
+			delete(c.pending, id)
+		}
+	}
+}
+
+// String encodes the cursor as the last ID followed by any skipped IDs, as
+// in "42" or "42:39,41".
+func (c *Cursor) String() string {
+	s := strconv.FormatInt(c.last, 10)
+	if len(c.pending) == 0 {
+		return s
+	}
+	ids := make([]int64, 0, len(c.pending))
+	for id := range c.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return s + ":" + strings.Join(parts, ",")
+}
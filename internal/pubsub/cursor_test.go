@@ -0,0 +1,91 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAfter returns the committed IDs after from, in ID order, the way the
+// events query does.
+func readAfter(committed []int64, from int64) []int64 {
+	var ids []int64
+	for _, id := range committed {
+		if id > from {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// relay reads everything after c.From() and returns the IDs accepted.
+func relay(c *Cursor, committed []int64, now time.Time) []int64 {
+	var accepted []int64
+	for _, id := range readAfter(committed, c.From()) {
+		if c.Accept(id, now) {
+			accepted = append(accepted, id)
+		}
+	}
+	return accepted
+}
+
+func TestCursorOutOfOrderCommits(t *testing.T) {
+	now := time.Now()
+	c := NewCursor(1)
+
+	// 2 and 3 were inserted concurrently and 3 committed first.
+	committed := []int64{1, 3}
+	assert.Equal(t, []int64{3}, relay(c, committed, now))
+	assert.Equal(t, "3:2", c.String())
+
+	committed = []int64{1, 2, 3}
+	assert.Equal(t, []int64{2}, relay(c, committed, now))
+	assert.Equal(t, "3", c.String())
+
+	// Nothing new is relayed twice.
+	assert.Empty(t, relay(c, committed, now))
+}
+
+func TestCursorResume(t *testing.T) {
+	now := time.Now()
+	c := NewCursor(1)
+	relay(c, []int64{1, 3}, now)
+
+	// A client reconnecting with the cursor still gets 2 once it commits.
+	resumed, err := ParseCursor(c.String(), now)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 4}, relay(resumed, []int64{1, 2, 3, 4}, now))
+}
+
+func TestCursorExpire(t *testing.T) {
+	now := time.Now()
+	c := NewCursor(1)
+	relay(c, []int64{1, 3}, now)
+
+	// 2 was rolled back and never commits.
+	c.Expire(now.Add(2*time.Minute), time.Minute)
+	assert.Equal(t, int64(3), c.From())
+	assert.Equal(t, "3", c.String())
+}
+
+func TestCursorZeroStartsAtFirstID(t *testing.T) {
+	var c Cursor
+	assert.True(t, c.Accept(40, time.Now()))
+	assert.Equal(t, "40", c.String())
+	assert.False(t, c.Accept(40, time.Now()))
+}
+
+func TestCursorWideGap(t *testing.T) {
+	c := NewCursor(1)
+	c.Accept(1000, time.Now())
+	assert.Equal(t, int64(1000-maxPending-1), c.From())
+}
+
+func TestParseCursorInvalid(t *testing.T) {
+	for _, s := range []string{"", "x", "-1", "5:7", "5:0", "5:a"} {
+		_, err := ParseCursor(s, time.Now())
+		assert.Error(t, err, s)
+	}
+}
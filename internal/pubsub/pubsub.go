@@ -0,0 +1,69 @@
+// Package pubsub fans messages out to in-process subscribers. A subscriber
+// that falls too far behind is dropped rather than slowing everyone else
+// down; it sees its channel closed and can resubscribe and catch up.
+package pubsub
+
+import "sync"
+
+// Broker delivers every published message to every current subscriber.
+// It is safe for concurrent use.
+type Broker[T any] struct {
+	mu     sync.Mutex
+	subs   map[*subscription[T]]struct{}
+	buffer int
+}
+
+type subscription[T any] struct {
+	ch     chan T
+	closed bool
+}
+
+// New returns a Broker that buffers up to buffer messages per subscriber.
+func New[T any](buffer int) *Broker[T] {
+	return &Broker[T]{subs: map[*subscription[T]]struct{}{}, buffer: buffer}
+}
+
+// Subscribe returns a channel of messages published from now on and a
+// function to unsubscribe. The channel is closed on unsubscribe or when the
+// subscriber falls behind.
+func (b *Broker[T]) Subscribe() (<-chan T, func()) {
+	sub := &subscription[T]{ch: make(chan T, b.buffer)}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(sub)
+	}
+}
+
+// drop must be called with b.mu held.
+func (b *Broker[T]) drop(sub *subscription[T]) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(b.subs, sub)
+	close(sub.ch)
+}
+
+// Publish delivers msg to every subscriber without blocking.
+func (b *Broker[T]) Publish(msg T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		select {
+		case sub.ch <- msg:
+		default:
+			b.drop(sub)
+		}
+	}
+}
+
+// Len returns the number of subscribers.
+func (b *Broker[T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
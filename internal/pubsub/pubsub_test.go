@@ -0,0 +1,35 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker(t *testing.T) {
+	b := New[int](2)
+	first, unsubscribeFirst := b.Subscribe()
+	second, unsubscribeSecond := b.Subscribe()
+	assert.Equal(t, 2, b.Len())
+
+	b.Publish(1)
+	assert.Equal(t, 1, <-first)
+	assert.Equal(t, 1, <-second)
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	_, open := <-first
+	assert.False(t, open)
+	assert.Equal(t, 1, b.Len())
+
+	// second never reads, so the third message overflows its buffer.
+	b.Publish(2)
+	b.Publish(3)
+	b.Publish(4)
+	assert.Equal(t, 0, b.Len())
+	assert.Equal(t, 2, <-second)
+	assert.Equal(t, 3, <-second)
+	_, open = <-second
+	assert.False(t, open)
+	unsubscribeSecond()
+}
@@ -0,0 +1,359 @@
+// Package websocket is a small server side implementation of RFC 6455,
+// enough for JSON messaging with browsers and other clients: the opening
+// handshake, fragmented messages, ping/pong and the closing handshake.
+// Extensions such as compression are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType is the type of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close codes from RFC 6455 section 7.4.1. Applications may use 4000-4999.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+	CloseTryAgainLater   = 1013
+)
+
+// DefaultReadLimit is the largest message a Conn accepts unless changed
+// with SetReadLimit.
+const DefaultReadLimit = 64 << 10
+
+// controlWriteTimeout bounds writing pongs and close frames.
+const controlWriteTimeout = 5 * time.Second
+
+// acceptGUID is appended to the client's key to prove the server speaks
+// WebSocket.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// CloseError is returned by ReadMessage once the connection is closed,
+// with the code and reason the peer or this side closed it with.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// Conn is a WebSocket connection. One goroutine may read while others
+// write; writes are serialized.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	readLimit   int64
+	idleTimeout time.Duration
+
+	writeMu  sync.Mutex
+	closeMu  sync.Mutex
+	closeErr *CloseError
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AcceptKey computes Sec-WebSocket-Accept for a client's Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Upgrade completes the opening handshake and takes over the connection.
+// On failure it has already written an error response.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "WebSocket upgrade requires GET", http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket: method not GET")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusBadRequest)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: invalid key")
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket upgrade not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+	// Clear any deadlines the server set for ordinary requests.
+	netConn.SetDeadline(time.Time{})
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err := rw.WriteString(resp); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &Conn{conn: netConn, br: rw.Reader, readLimit: DefaultReadLimit}, nil
+}
+
+// SetReadLimit sets the largest message ReadMessage accepts. Larger
+// messages close the connection with CloseMessageTooBig.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetIdleTimeout makes ReadMessage fail if no frame at all, pongs
+// included, arrives for d. Pinging regularly keeps a healthy client from
+// timing out.
+func (c *Conn) SetIdleTimeout(d time.Duration) {
+	c.idleTimeout = d
+}
+
+type frame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+func (c *Conn) readFrame(limit int64) (frame, error) {
+	if c.idleTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	}
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{fin: header[0]&0x80 != 0, opcode: header[0] & 0x0F}
+	if header[0]&0x70 != 0 {
+		return f, &CloseError{Code: CloseProtocolError, Reason: "reserved bits set"}
+	}
+	if header[1]&0x80 == 0 {
+		return f, &CloseError{Code: CloseProtocolError, Reason: "client frames must be masked"}
+	}
+
+	length := int64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		n := binary.BigEndian.Uint64(ext[:])
+		if n > 1<<62 {
+			return f, &CloseError{Code: CloseProtocolError, Reason: "invalid frame length"}
+		}
+		length = int64(n)
+	}
+	if f.opcode >= opClose && (length > 125 || !f.fin) {
+		return f, &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+	}
+	if length > limit {
+		return f, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// ReadMessage returns the next data message, answering pings and
+// completing the closing handshake along the way. Once the connection is
+// closed it returns a *CloseError.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var typ MessageType
+	var message []byte
+	for {
+		f, err := c.readFrame(c.readLimit - int64(len(message)))
+		var closeErr *CloseError
+		if errors.As(err, &closeErr) {
+			c.Close(closeErr.Code, closeErr.Reason)
+			return 0, nil, closeErr
+		}
+		if err != nil {
+			c.conn.Close()
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, f.payload, time.Now().Add(controlWriteTimeout)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			closeErr := &CloseError{Code: CloseNoStatus}
+			if len(f.payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(f.payload))
+				closeErr.Reason = string(f.payload[2:])
+			}
+			code := closeErr.Code
+			if code == CloseNoStatus {
+				code = CloseNormal
+			}
+			c.Close(code, "")
+			return 0, nil, closeErr
+		case opText, opBinary:
+			if typ != 0 {
+				c.Close(CloseProtocolError, "expected continuation frame")
+				return 0, nil, &CloseError{Code: CloseProtocolError, Reason: "expected continuation frame"}
+			}
+			typ = MessageType(f.opcode)
+		case opContinuation:
+			if typ == 0 {
+				c.Close(CloseProtocolError, "unexpected continuation frame")
+				return 0, nil, &CloseError{Code: CloseProtocolError, Reason: "unexpected continuation frame"}
+			}
+		default:
+			c.Close(CloseProtocolError, "unknown opcode")
+			return 0, nil, &CloseError{Code: CloseProtocolError, Reason: "unknown opcode"}
+		}
+
+		message = append(message, f.payload...)
+		if !f.fin {
+			continue
+		}
+		if typ == TextMessage && !utf8.Valid(message) {
+			c.Close(CloseInvalidPayload, "invalid UTF-8")
+			return 0, nil, &CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8"}
+		}
+		return typ, message, nil
+	}
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte, deadline time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(deadline)
+
+	header := make([]byte, 0, 10)
+	header = append(header, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteMessage sends a data message. The deadline, if not zero, bounds how
+// long a slow client can hold up the write.
+func (c *Conn) WriteMessage(typ MessageType, data []byte, deadline time.Time) error {
+	if err := c.closed(); err != nil {
+		return err
+	}
+	return c.writeFrame(byte(typ), data, deadline)
+}
+
+// Ping sends a ping; the client answers with a pong ReadMessage discards.
+func (c *Conn) Ping(deadline time.Time) error {
+	if err := c.closed(); err != nil {
+		return err
+	}
+	return c.writeFrame(opPing, nil, deadline)
+}
+
+func (c *Conn) closed() error {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	if c.closeErr != nil {
+		return c.closeErr
+	}
+	return nil
+}
+
+// Close sends a close frame with code and reason and closes the
+// connection. Only the first call has any effect.
+func (c *Conn) Close(code int, reason string) error {
+	c.closeMu.Lock()
+	if c.closeErr != nil {
+		c.closeMu.Unlock()
+		return nil
+	}
+	c.closeErr = &CloseError{Code: code, Reason: reason}
+	c.closeMu.Unlock()
+
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	c.writeFrame(opClose, payload, time.Now().Add(controlWriteTimeout))
+	return c.conn.Close()
+}
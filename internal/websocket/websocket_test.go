@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455 section 1.3.
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+// dial performs the opening handshake against srv.
+func dial(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	return conn, br
+}
+
+func writeClientFrame(t *testing.T, conn net.Conn, fin bool, opcode byte, payload []byte) {
+	t.Helper()
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{first, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func readServerFrame(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	_, err := io.ReadFull(br, header[:])
+	require.NoError(t, err)
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(br, payload)
+	require.NoError(t, err)
+	return header[0] & 0x0F, payload
+}
+
+func TestEcho(t *testing.T) {
+	closed := make(chan *CloseError, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				closeErr, _ := err.(*CloseError)
+				closed <- closeErr
+				return
+			}
+			conn.WriteMessage(typ, msg, time.Now().Add(time.Second))
+		}
+	}))
+	defer srv.Close()
+
+	conn, br := dial(t, srv)
+	defer conn.Close()
+
+	writeClientFrame(t, conn, true, opText, []byte("hello"))
+	op, payload := readServerFrame(t, br)
+	assert.Equal(t, byte(opText), op)
+	assert.Equal(t, "hello", string(payload))
+
+	// A fragmented message with a ping in between.
+	writeClientFrame(t, conn, false, opText, []byte("chi"))
+	writeClientFrame(t, conn, true, opPing, []byte("p"))
+	writeClientFrame(t, conn, true, opContinuation, []byte("rp"))
+	op, payload = readServerFrame(t, br)
+	assert.Equal(t, byte(opPong), op)
+	assert.Equal(t, "p", string(payload))
+	op, payload = readServerFrame(t, br)
+	assert.Equal(t, byte(opText), op)
+	assert.Equal(t, "chirp", string(payload))
+
+	writeClientFrame(t, conn, true, opClose, binary.BigEndian.AppendUint16(nil, CloseGoingAway))
+	op, payload = readServerFrame(t, br)
+	assert.Equal(t, byte(opClose), op)
+	assert.Equal(t, uint16(CloseGoingAway), binary.BigEndian.Uint16(payload))
+	assert.Equal(t, CloseGoingAway, (<-closed).Code)
+}
+
+func TestUnmaskedFrameIsRejected(t *testing.T) {
+	closed := make(chan *CloseError, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		_, _, err = conn.ReadMessage()
+		closeErr, _ := err.(*CloseError)
+		closed <- closeErr
+	}))
+	defer srv.Close()
+
+	conn, br := dial(t, srv)
+	defer conn.Close()
+	conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+
+	op, payload := readServerFrame(t, br)
+	assert.Equal(t, byte(opClose), op)
+	assert.Equal(t, uint16(CloseProtocolError), binary.BigEndian.Uint16(payload))
+	assert.Equal(t, CloseProtocolError, (<-closed).Code)
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Upgrade(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hconn7/Chirpy/internal/auth"
+)
+
+// loadJwtKeys builds the key set used for access tokens. Without
+// JWT_PRIVATE_KEY_FILE tokens keep being signed with SECRET_TOKEN. With it,
+// new tokens are signed by that key while SECRET_TOKEN and any retired public
+// keys in JWT_VERIFICATION_KEY_FILES stay valid for tokens already issued.
+// Once every HMAC token has expired, JWT_DISABLE_HMAC=true stops accepting
+// them.
+func loadJwtKeys(secret string) (*auth.KeySet, error) {
+	privateKeyFile := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	disableHMAC := os.Getenv("JWT_DISABLE_HMAC") == "true"
+	if privateKeyFile == "" {
+		if disableHMAC {
+			return nil, errors.New("JWT_DISABLE_HMAC needs JWT_PRIVATE_KEY_FILE")
+		}
+		return auth.NewKeySet(auth.NewHMACKey(secret)), nil
+	}
+
+	data, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	private, err := auth.ParsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", privateKeyFile, err)
+	}
+	signing, err := auth.NewSigningKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	var verification []*auth.SigningKey
+	if secret != "" && !disableHMAC {
+		verification = append(verification, auth.NewHMACKey(secret))
+	}
+	for _, file := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		public, err := auth.ParsePublicKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", file, err)
+		}
+		key, err := auth.NewVerificationKey(public)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+
+	return auth.NewKeySet(signing, verification...), nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hconn7/Chirpy/internal/lockout"
+)
+
+// loadLockoutConfig reads the login throttling thresholds, falling back to
+// lockout.DefaultConfig for anything unset.
+func loadLockoutConfig() lockout.Config {
+	cfg := lockout.DefaultConfig()
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ACCOUNT_FAILURES")); err == nil {
+		cfg.MaxAccountFailures = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_IP_FAILURES")); err == nil {
+		cfg.MaxIPFailures = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_DURATION")); err == nil {
+		cfg.LockoutDuration = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_BASE_DELAY")); err == nil {
+		cfg.BaseDelay = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_MAX_DELAY")); err == nil {
+		cfg.MaxDelay = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_FAILURE_WINDOW")); err == nil {
+		cfg.Window = d
+	}
+	return cfg
+}
@@ -1,24 +1,55 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"sync/atomic"
+	"time"
 
+	"github.com/hconn7/Chirpy/internal/auth"
 	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/filter"
+	"github.com/hconn7/Chirpy/internal/lockout"
+	"github.com/hconn7/Chirpy/internal/mailer"
+	"github.com/hconn7/Chirpy/internal/oauth"
+	"github.com/hconn7/Chirpy/internal/oidc"
+	"github.com/hconn7/Chirpy/internal/pubsub"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	compiledFilter atomic.Pointer[filter.Matcher]
+	chirpEvents    *pubsub.Broker[database.ChirpEvent]
+	db             *sql.DB
 	dbQueries      *database.Queries
 	Platform       string
 	JwtSecret      string
-	ApiKey         string
+	JwtKeys        *auth.KeySet
+	Mailer         mailer.Mailer
+	BaseURL        string
+	LoginGuard     *lockout.Guard
+	// ResetGuard throttles password reset requests per email and IP, and
+	// resetSends bounds how many reset emails are sent at once.
+	ResetGuard     *lockout.Guard
+	resetSends     chan struct{}
+	Passwords      *auth.Hasher
+	PasswordPolicy *auth.PasswordPolicy
+	OIDCProviders  map[string]*oidc.Client
+	// notificationEvents carries new and updated notifications to this
+	// instance's WebSocket clients.
+	notificationEvents *pubsub.Broker[database.Notification]
+	// DeletionGracePeriod is how long a deleted account can be restored by
+	// logging in before it is purged.
+	DeletionGracePeriod time.Duration
+	// AdminBootstrapEmail is promoted to admin while no admin exists.
+	AdminBootstrapEmail string
+	ApiKey              string
 }
 type httpServer struct {
 	handler http.Handler
@@ -35,38 +66,154 @@ func main() {
 	tokenSecret := os.Getenv("SECRET_TOKEN")
 	platform := os.Getenv("PLATFORM")
 	apiKey := os.Getenv("API_KEY")
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	deletionGracePeriod := 30 * 24 * time.Hour
+	if d, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")); err == nil {
+		deletionGracePeriod = d
+	}
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		fmt.Print(err)
 	}
 	dbQueries := database.New(db)
+	jwtKeys, err := loadJwtKeys(tokenSecret)
+	if err != nil {
+		log.Fatalf("Error loading JWT keys: %v", err)
+	}
+	mail, err := mailer.FromEnv(platform == "dev")
+	if err != nil {
+		log.Fatalf("Error configuring mailer: %v", err)
+	}
+	passwords, err := loadPasswordHasher()
+	if err != nil {
+		log.Fatalf("Error configuring password hashing: %v", err)
+	}
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Error loading password policy: %v", err)
+	}
+	oidcProviders, err := loadOIDCProviders(baseURL)
+	if err != nil {
+		log.Fatalf("Error configuring OpenID Connect providers: %v", err)
+	}
 	apiCfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		dbQueries:      dbQueries,
-		Platform:       platform,
-		JwtSecret:      tokenSecret,
-		ApiKey:         apiKey,
+		fileserverHits:      atomic.Int32{},
+		chirpEvents:         pubsub.New[database.ChirpEvent](256),
+		notificationEvents:  pubsub.New[database.Notification](256),
+		db:                  db,
+		dbQueries:           dbQueries,
+		Platform:            platform,
+		JwtSecret:           tokenSecret,
+		JwtKeys:             jwtKeys,
+		Mailer:              mail,
+		resetSends:          make(chan struct{}, maxPasswordResetSends),
+		BaseURL:             baseURL,
+		Passwords:           passwords,
+		PasswordPolicy:      passwordPolicy,
+		OIDCProviders:       oidcProviders,
+		DeletionGracePeriod: deletionGracePeriod,
+		AdminBootstrapEmail: os.Getenv("ADMIN_BOOTSTRAP_EMAIL"),
+		ApiKey:              apiKey,
 	}
+	apiCfg.LoginGuard = lockout.New(loadLockoutConfig(), time.Now, apiCfg.auditLockoutEvent)
+	apiCfg.ResetGuard = lockout.New(passwordResetLockoutConfig(), time.Now, nil)
+	apiCfg.bootstrapAdmin(context.Background())
+	go apiCfg.runAccountPurger(time.Hour)
+	go apiCfg.runChirpFilterReloader(time.Minute)
+	go apiCfg.runRestrictionLifter(time.Minute)
+	go apiCfg.runChirpEventListener(dbURL)
+	oauthServer := oauth.NewServer(oauthStore{db: dbQueries}, jwtKeys, apiCfg.authenticateConsent)
 	mux := http.NewServeMux()
 	httpServ := httpServer{handler: mux, address: ":8080"}
 	fileServer := http.FileServer(http.Dir("."))
 	//Handlers
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
+	mux.Handle("DELETE /api/chirps/{chirpID}", apiCfg.requireAuth(auth.ScopeChirpsWrite, apiCfg.handlerDeleteChirp))
+	mux.Handle("DELETE /api/sessions/{id}", apiCfg.requireAuth(auth.ScopeSessions, apiCfg.handlerRevokeSession))
+	mux.Handle("DELETE /api/tokens/{id}", apiCfg.requireAuth(auth.ScopeTokens, apiCfg.handlerRevokeToken))
+	mux.Handle("DELETE /api/users/me", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerDeleteAccount))
+	mux.Handle("DELETE /api/users/me/blocks/{userID}", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerUnblockUser))
+	mux.Handle("DELETE /api/users/me/mutes/{userID}", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerUnmuteUser))
+	mux.Handle("DELETE /api/users/me/muted-words/{id}", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerUnmuteWord))
+	mux.Handle("DELETE /api/users/totp", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerDisableTOTP))
+	mux.Handle("DELETE /admin/lockouts/{kind}/{key}", apiCfg.MiddlewareRequirePermission(auth.PermManageLockouts, http.HandlerFunc(apiCfg.handlerUnlock)))
+	mux.Handle("DELETE /api/oauth/clients/{id}", apiCfg.requireAuth(auth.ScopeTokens, apiCfg.handlerRevokeOAuthClient))
+	mux.Handle("DELETE /api/moderation/chirps/{chirpID}", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerModerateDeleteChirp)))
+	mux.Handle("DELETE /api/moderation/reports/{reportID}/claim", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerUnclaimReport)))
+	mux.Handle("DELETE /api/moderation/users/{userID}/suspension", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerLiftSuspension)))
+	mux.Handle("DELETE /api/moderation/users/{userID}/shadow-ban", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerLiftShadowBan)))
+	mux.Handle("DELETE /admin/filters/{id}", apiCfg.MiddlewareRequirePermission(auth.PermManageFilters, http.HandlerFunc(apiCfg.handlerDeleteFilterRule)))
+
+	mux.Handle("PATCH /api/users/me", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerPatchProfile))
 
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
+	mux.Handle("PUT /api/users", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerUpdateUser))
+	mux.Handle("PUT /api/users/me/password", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerChangePassword))
+	mux.Handle("PUT /admin/users/{userID}/role", apiCfg.MiddlewareRequirePermission(auth.PermManageRoles, http.HandlerFunc(apiCfg.handlerSetUserRole)))
+	mux.Handle("PUT /admin/filters/{id}", apiCfg.MiddlewareRequirePermission(auth.PermManageFilters, http.HandlerFunc(apiCfg.handlerUpdateFilterRule)))
 
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerValidateRefreshToken)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerWebhooks)
+	mux.Handle("POST /api/polka/webhooks", apiCfg.requireAuth(auth.ScopeWebhooks, apiCfg.handlerWebhooks))
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevokeRefreshToken)
+	mux.Handle("POST /api/sessions/revoke-all", apiCfg.requireAuth(auth.ScopeSessions, apiCfg.handlerRevokeAllSessions))
+	mux.Handle("POST /api/tokens", apiCfg.requireAuth(auth.ScopeTokens, apiCfg.handlerCreateToken))
+	mux.Handle("POST /api/oauth/clients", apiCfg.requireAuth(auth.ScopeTokens, apiCfg.handlerCreateOAuthClient))
+	mux.HandleFunc("POST /oauth/authorize", oauthServer.HandleAuthorize)
+	mux.HandleFunc("POST /oauth/token", oauthServer.HandleToken)
 	mux.HandleFunc("POST /api/login", apiCfg.handlerValidateLogin)
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerResetUsers)
+	mux.HandleFunc("POST /api/login/totp", apiCfg.handlerLoginTOTP)
+	mux.HandleFunc("POST /api/password-reset/request", apiCfg.handlerRequestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.handlerConfirmPasswordReset)
+	mux.Handle("POST /api/chirps", apiCfg.requireAuth(auth.ScopeChirpsWrite, apiCfg.handlerCreateChirp))
+	mux.Handle("POST /api/chirps/{chirpID}/reports", apiCfg.requireAuth(auth.ScopeChirpsWrite, apiCfg.handlerCreateReport))
+	mux.Handle("POST /api/moderation/reports/{reportID}/claim", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerClaimReport)))
+	mux.Handle("POST /api/moderation/reports/{reportID}/resolve", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerResolveReport)))
+	mux.Handle("POST /api/moderation/users/{userID}/suspension", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerSuspendUser)))
+	mux.Handle("POST /api/moderation/users/{userID}/shadow-ban", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerShadowBanUser)))
+	mux.Handle("POST /admin/reset", apiCfg.MiddlewareRequirePermission(auth.PermResetData, http.HandlerFunc(apiCfg.handlerResetUsers)))
+	mux.Handle("POST /admin/filters", apiCfg.MiddlewareRequirePermission(auth.PermManageFilters, http.HandlerFunc(apiCfg.handlerCreateFilterRule)))
 	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
+	mux.Handle("POST /api/users/totp", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerEnrollTOTP))
+	mux.Handle("POST /api/users/totp/verify", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerConfirmTOTP))
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerVerifyEmail)
+	mux.Handle("POST /api/users/verify/resend", apiCfg.requireAuth("", apiCfg.handlerResendVerification))
+	mux.Handle("POST /api/users/me/email", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerChangeEmail))
+	mux.Handle("POST /api/users/me/blocks", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerBlockUser))
+	mux.Handle("POST /api/users/me/mutes", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerMuteUser))
+	mux.Handle("POST /api/users/me/muted-words", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerMuteWord))
+	mux.HandleFunc("POST /api/users/email/confirm", apiCfg.handlerConfirmEmailChange)
 
-	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetAllChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.hanlerGetSingleChirp)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.writeHits)
+	mux.Handle("GET /api/chirps", apiCfg.optionalAuth(apiCfg.handlerGetAllChirps))
+	mux.Handle("GET /ws", wsTokenFromQuery(apiCfg.requireAuth(auth.ScopeChirpsRead, apiCfg.handlerWebSocket)))
+	mux.Handle("GET /api/chirps/stream", apiCfg.optionalAuth(apiCfg.handlerChirpStream))
+	mux.Handle("GET /api/notifications", apiCfg.requireAuth(auth.ScopeChirpsRead, apiCfg.handlerGetNotifications))
+	mux.Handle("POST /api/notifications/{id}/read", apiCfg.requireAuth(auth.ScopeChirpsWrite, apiCfg.handlerMarkNotificationRead))
+	mux.Handle("POST /api/notifications/read-all", apiCfg.requireAuth(auth.ScopeChirpsWrite, apiCfg.handlerMarkAllNotificationsRead))
+	mux.Handle("GET /api/notifications/preferences", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerGetNotificationPreferences))
+	mux.Handle("PUT /api/notifications/preferences", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerUpdateNotificationPreferences))
+	mux.Handle("GET /api/chirps/{chirpID}", apiCfg.optionalAuth(apiCfg.hanlerGetSingleChirp))
+	mux.Handle("GET /api/moderation/reports", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerGetReports)))
+	mux.Handle("GET /api/moderation/reports/{reportID}", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerGetReport)))
+	mux.Handle("GET /api/moderation/actions", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerGetModerationActions)))
+	mux.Handle("GET /api/moderation/users/{userID}", apiCfg.MiddlewareRequirePermission(auth.PermModerateChirps, http.HandlerFunc(apiCfg.handlerGetUserRestrictions)))
+	mux.Handle("GET /api/sessions", apiCfg.requireAuth(auth.ScopeSessions, apiCfg.handlerGetSessions))
+	mux.Handle("GET /api/tokens", apiCfg.requireAuth(auth.ScopeTokens, apiCfg.handlerGetTokens))
+	mux.Handle("GET /api/users/me", apiCfg.requireAuth(auth.ScopeUserRead, apiCfg.handlerGetProfile))
+	mux.Handle("GET /api/users/me/export", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerExportAccount))
+	mux.Handle("GET /api/users/me/blocks", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerGetBlocks))
+	mux.Handle("GET /api/users/me/mutes", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerGetMutes))
+	mux.Handle("GET /api/users/me/muted-words", apiCfg.requireAuth(auth.ScopeUserWrite, apiCfg.handlerGetMutedWords))
+	mux.Handle("GET /api/oauth/clients", apiCfg.requireAuth(auth.ScopeTokens, apiCfg.handlerGetOAuthClients))
+	mux.HandleFunc("GET /oauth/authorize", oauthServer.HandleAuthorize)
+	mux.HandleFunc("GET /api/login/oidc/{provider}", apiCfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/login/oidc/{provider}/callback", apiCfg.handlerOIDCCallback)
+	mux.Handle("GET /admin/metrics", apiCfg.MiddlewareRequirePermission(auth.PermViewMetrics, http.HandlerFunc(apiCfg.writeHits)))
+	mux.Handle("GET /admin/lockouts", apiCfg.MiddlewareRequirePermission(auth.PermManageLockouts, http.HandlerFunc(apiCfg.handlerGetLockouts)))
+	mux.Handle("GET /admin/filters", apiCfg.MiddlewareRequirePermission(auth.PermManageFilters, http.HandlerFunc(apiCfg.handlerGetFilterRules)))
+	mux.Handle("GET /admin/audit", apiCfg.MiddlewareRequirePermission(auth.PermViewAudit, http.HandlerFunc(apiCfg.handlerGetAuditEvents)))
 	mux.HandleFunc("GET /api/healthz", HandlerHealthz)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 	mux.Handle("/app/", http.StripPrefix("/app/", apiCfg.MiddlewareMetricsInc((fileServer))))
 	//Serve
 	http.ListenAndServe(httpServ.address, httpServ.handler)
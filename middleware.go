@@ -1,6 +1,12 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+)
 
 func (cfg *apiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -8,3 +14,40 @@ func (cfg *apiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+type actorContextKey struct{}
+
+// MiddlewareRequirePermission only lets through authenticated users whose
+// role grants perm. The role is read from the database rather than the token
+// so a demotion takes effect immediately. The caller's user record is stored
+// in the request context for actorFromContext.
+//
+// Only access tokens from the user's own logins are accepted. Personal
+// access tokens, tokens issued to OAuth clients and the webhook API key
+// never carry admin or moderator powers, whatever their scopes.
+func (cfg *apiConfig) MiddlewareRequirePermission(perm auth.Permission, next http.Handler) http.Handler {
+	return cfg.MiddlewareAuthenticate(authRequired, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		if principal.Method != auth.AuthMethodJWT {
+			respondWithError(w, 403, "Forbidden", nil)
+			return
+		}
+		user, err := cfg.dbQueries.GetUserByID(r.Context(), principal.UserID)
+		if err != nil {
+			respondWithError(w, 403, "Forbidden", err)
+			return
+		}
+		if !auth.Role(user.Role).Can(perm) {
+			respondWithError(w, 403, "Forbidden", nil)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), actorContextKey{}, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}))
+}
+
+func actorFromContext(ctx context.Context) (database.User, bool) {
+	user, ok := ctx.Value(actorContextKey{}).(database.User)
+	return user, ok
+}
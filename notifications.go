@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+const (
+	notificationFollow       = "follow"
+	notificationLike         = "like"
+	notificationReply        = "reply"
+	notificationMention      = "mention"
+	notificationRechirp      = "rechirp"
+	notificationSubscription = "subscription"
+
+	// notificationsChannel is the Postgres NOTIFY channel new and updated
+	// notifications are announced on.
+	notificationsChannel = "notifications"
+)
+
+// notificationTypes are the types a user can turn on or off, in the order
+// their preferences are listed.
+var notificationTypes = []string{
+	notificationFollow,
+	notificationLike,
+	notificationReply,
+	notificationMention,
+	notificationRechirp,
+	notificationSubscription,
+}
+
+func isNotificationType(s string) bool {
+	for _, t := range notificationTypes {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationEvent is something a user is told about. ActorID is who did
+// it, or uuid.Nil for the system. EventID, if set, identifies the external
+// delivery that raised it, so a redelivery notifies no one.
+type notificationEvent struct {
+	UserID  uuid.UUID
+	Type    string
+	ActorID uuid.UUID
+	ChirpID uuid.NullUUID
+	Details string
+	EventID string
+}
+
+// notificationGroupKey decides which unread notifications an event folds
+// into: likes and rechirps of the same chirp, and new followers, are
+// counted together. Everything else stands on its own.
+func notificationGroupKey(event notificationEvent) string {
+	switch event.Type {
+	case notificationLike, notificationRechirp:
+		return event.Type + ":" + event.ChirpID.UUID.String()
+	case notificationFollow:
+		return notificationFollow
+	}
+	return event.Type + ":" + uuid.NewString()
+}
+
+// notify records a notification and announces it to every instance's
+// realtime clients. Nothing is recorded if the user turned the type off or
+// blocked or muted the actor, or was already notified of the same EventID.
+// Like audit, failing to notify doesn't fail the request.
+func (cfg *apiConfig) notify(ctx context.Context, event notificationEvent) {
+	if event.UserID == event.ActorID {
+		return
+	}
+	actorIDs := []uuid.UUID{}
+	if event.ActorID != uuid.Nil {
+		actorIDs = append(actorIDs, event.ActorID)
+	}
+	notification, err := cfg.dbQueries.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:   event.UserID,
+		Type:     event.Type,
+		GroupKey: notificationGroupKey(event),
+		ChirpID:  event.ChirpID,
+		ActorIds: actorIDs,
+		Details:  event.Details,
+		EventID:  event.EventID,
+	})
+	// A unique violation is a concurrent redelivery of the same event.
+	if errors.Is(err, sql.ErrNoRows) || isUniqueViolation(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't record %s notification for %s: %v", event.Type, event.UserID, err)
+		return
+	}
+	if err := cfg.dbQueries.NotifyNotification(ctx, notification.ID.String()); err != nil {
+		log.Printf("Couldn't announce notification %s: %v", notification.ID, err)
+	}
+}
+
+// relayNotification hands a notification announced on notificationsChannel
+// to this instance's subscribers.
+func (cfg *apiConfig) relayNotification(ctx context.Context, payload string) {
+	id, err := uuid.Parse(payload)
+	if err != nil {
+		log.Printf("Invalid notification announced: %q", payload)
+		return
+	}
+	notification, err := cfg.dbQueries.GetNotificationByID(ctx, id)
+	if err != nil {
+		log.Printf("Couldn't retrieve notification %s: %v", id, err)
+		return
+	}
+	cfg.notificationEvents.Publish(notification)
+}
+
+// notificationSummary describes a notification in a sentence, counting the
+// events folded into it.
+func notificationSummary(n database.Notification) string {
+	who := "Someone"
+	if n.Count > 1 {
+		who = fmt.Sprintf("%d people", n.Count)
+	}
+	switch n.Type {
+	case notificationFollow:
+		return who + " followed you"
+	case notificationLike:
+		return who + " liked your chirp"
+	case notificationReply:
+		return who + " replied to your chirp"
+	case notificationMention:
+		return who + " mentioned you"
+	case notificationRechirp:
+		return who + " rechirped your chirp"
+	case notificationSubscription:
+		if n.Details == subscriptionChirpyRed {
+			return "Your Chirpy Red subscription is active"
+		}
+		return "Your subscription changed"
+	}
+	return ""
+}
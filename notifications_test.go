@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+func TestNotificationSummary(t *testing.T) {
+	var tests = []struct {
+		notification database.Notification
+		want         string
+	}{
+		{database.Notification{Type: notificationLike, Count: 1}, "Someone liked your chirp"},
+		{database.Notification{Type: notificationLike, Count: 5}, "5 people liked your chirp"},
+		{database.Notification{Type: notificationFollow, Count: 2}, "2 people followed you"},
+		{database.Notification{Type: notificationSubscription, Count: 1, Details: subscriptionChirpyRed}, "Your Chirpy Red subscription is active"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := notificationSummary(tt.notification); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotificationGroupKey(t *testing.T) {
+	chirp := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+	otherChirp := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+	key := func(eventType string, chirpID uuid.NullUUID) string {
+		return notificationGroupKey(notificationEvent{Type: eventType, ActorID: uuid.New(), ChirpID: chirpID})
+	}
+
+	var tests = []struct {
+		name    string
+		a, b    string
+		grouped bool
+	}{
+		{"likes of the same chirp", key(notificationLike, chirp), key(notificationLike, chirp), true},
+		{"likes of different chirps", key(notificationLike, chirp), key(notificationLike, otherChirp), false},
+		{"rechirps of the same chirp", key(notificationRechirp, chirp), key(notificationRechirp, chirp), true},
+		{"like and rechirp of the same chirp", key(notificationLike, chirp), key(notificationRechirp, chirp), false},
+		{"follows", key(notificationFollow, uuid.NullUUID{}), key(notificationFollow, uuid.NullUUID{}), true},
+		{"replies to the same chirp", key(notificationReply, chirp), key(notificationReply, chirp), false},
+		{"mentions", key(notificationMention, chirp), key(notificationMention, chirp), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a == tt.b; got != tt.grouped {
+				t.Errorf("grouped = %v, want %v (%s, %s)", got, tt.grouped, tt.a, tt.b)
+			}
+		})
+	}
+}
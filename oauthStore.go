@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/database"
+	"github.com/hconn7/Chirpy/internal/oauth"
+)
+
+// oauthStore keeps OAuth clients and grants in Postgres.
+type oauthStore struct {
+	db *database.Queries
+}
+
+func oauthNotFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauth.ErrNotFound
+	}
+	return err
+}
+
+func (s oauthStore) GetClient(ctx context.Context, id uuid.UUID) (oauth.Client, error) {
+	client, err := s.db.GetOAuthClientByID(ctx, id)
+	if err != nil {
+		return oauth.Client{}, oauthNotFound(err)
+	}
+	return oauth.Client{
+		ID:           client.ID,
+		Name:         client.Name,
+		SecretHash:   client.SecretHash.String,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Revoked:      client.RevokedAt.Valid,
+	}, nil
+}
+
+func (s oauthStore) CreateAuthorizationCode(ctx context.Context, code oauth.AuthorizationCode) error {
+	return s.db.CreateOAuthAuthorizationCode(ctx, database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      code.CodeHash,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+		RedirectUri:   code.RedirectURI,
+		Scopes:        code.Scopes,
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	})
+}
+
+func (s oauthStore) UseAuthorizationCode(ctx context.Context, codeHash string) (oauth.AuthorizationCode, error) {
+	code, err := s.db.UseOAuthAuthorizationCode(ctx, codeHash)
+	if err != nil {
+		return oauth.AuthorizationCode{}, oauthNotFound(err)
+	}
+	return oauth.AuthorizationCode{
+		CodeHash:      code.CodeHash,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+		RedirectURI:   code.RedirectUri,
+		Scopes:        code.Scopes,
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	}, nil
+}
+
+func (s oauthStore) CreateRefreshToken(ctx context.Context, token oauth.RefreshToken) error {
+	return s.db.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+		TokenHash: token.TokenHash,
+		ClientID:  token.ClientID,
+		UserID:    token.UserID,
+		Scopes:    token.Scopes,
+		ExpiresAt: token.ExpiresAt,
+	})
+}
+
+func (s oauthStore) UseRefreshToken(ctx context.Context, tokenHash string) (oauth.RefreshToken, error) {
+	token, err := s.db.UseOAuthRefreshToken(ctx, tokenHash)
+	if err != nil {
+		return oauth.RefreshToken{}, oauthNotFound(err)
+	}
+	return oauth.RefreshToken{
+		TokenHash: token.TokenHash,
+		ClientID:  token.ClientID,
+		UserID:    token.UserID,
+		Scopes:    token.Scopes,
+		ExpiresAt: token.ExpiresAt,
+	}, nil
+}
+
+var errConsentLogin = errors.New("Email, password or code is incorrect")
+
+// authenticateConsent logs a user in from the OAuth consent form with the
+// same throttling and second factor as /api/login.
+func (cfg *apiConfig) authenticateConsent(r *http.Request) (uuid.UUID, error) {
+	email := r.PostFormValue("email")
+	account, ip := loginAccount(email), clientIP(r)
+	if !cfg.LoginGuard.Check(account, ip).Allowed {
+		return uuid.Nil, errors.New("Too many failed login attempts, try again later")
+	}
+
+	user, err := cfg.dbQueries.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		cfg.LoginGuard.RecordFailure(account, ip)
+		return uuid.Nil, errConsentLogin
+	}
+	password := r.PostFormValue("password")
+	if err := cfg.Passwords.Verify(user.HashedPassword, password); err != nil {
+		cfg.LoginGuard.RecordFailure(account, ip)
+		return uuid.Nil, errConsentLogin
+	}
+	if user.TotpEnabled && !cfg.checkTOTPCode(r.Context(), user, r.PostFormValue("code")) {
+		cfg.LoginGuard.RecordFailure(account, ip)
+		return uuid.Nil, errConsentLogin
+	}
+
+	if isSuspended(user, time.Now()) {
+		return uuid.Nil, errors.New("This account is suspended")
+	}
+	// Only now, with both factors checked, are earlier failures forgiven.
+	cfg.LoginGuard.RecordSuccess(account, ip)
+	cfg.rehashIfNeeded(r.Context(), user, password)
+	return user.ID, nil
+}
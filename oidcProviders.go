@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hconn7/Chirpy/internal/oidc"
+)
+
+// loadOIDCProviders reads the comma separated names in OIDC_PROVIDERS. Each
+// name needs OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and
+// OIDC_<NAME>_CLIENT_SECRET, and may set OIDC_<NAME>_SCOPES. The provider
+// must allow BASE_URL/api/login/oidc/<name>/callback as a redirect URI.
+func loadOIDCProviders(baseURL string) (map[string]*oidc.Client, error) {
+	providers := map[string]*oidc.Client{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  strings.TrimSuffix(baseURL, "/") + "/api/login/oidc/" + name + "/callback",
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("provider %s needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers[name] = oidc.NewClient(config, nil)
+	}
+	return providers, nil
+}
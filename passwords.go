@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/hconn7/Chirpy/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loadPasswordHasher picks the algorithm for new password hashes from
+// PASSWORD_HASH ("argon2id", the default, or "bcrypt"). Hashes made by the
+// other algorithm still verify and are upgraded on the user's next login.
+func loadPasswordHasher() (*auth.Hasher, error) {
+	bcryptHasher := auth.BcryptHasher{Cost: bcrypt.DefaultCost}
+	if n, err := strconv.Atoi(os.Getenv("BCRYPT_COST")); err == nil {
+		bcryptHasher.Cost = n
+	}
+
+	argonHasher := auth.Argon2idHasher{Params: auth.DefaultArgon2idParams}
+	if n, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY_KIB"), 10, 32); err == nil {
+		argonHasher.Params.Memory = uint32(n)
+	}
+	if n, err := strconv.ParseUint(os.Getenv("ARGON2_ITERATIONS"), 10, 32); err == nil {
+		argonHasher.Params.Iterations = uint32(n)
+	}
+	if n, err := strconv.ParseUint(os.Getenv("ARGON2_PARALLELISM"), 10, 8); err == nil {
+		argonHasher.Params.Parallelism = uint8(n)
+	}
+	if err := argonHasher.Params.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch os.Getenv("PASSWORD_HASH") {
+	case "", "argon2id":
+		return auth.NewHasher(argonHasher, bcryptHasher), nil
+	case "bcrypt":
+		return auth.NewHasher(bcryptHasher, argonHasher), nil
+	}
+	return nil, fmt.Errorf("Unknown PASSWORD_HASH %q", os.Getenv("PASSWORD_HASH"))
+}
+
+func loadPasswordPolicy() (*auth.PasswordPolicy, error) {
+	minLength := 8
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil {
+		minLength = n
+	}
+	policy := auth.NewPasswordPolicy(minLength, 128)
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		if err := policy.LoadBreachedPasswords(path); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
@@ -21,6 +21,17 @@ func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
 	respondWithJson(w, code, errorResponse{Error: msg})
 }
 
+// fieldErrors maps request fields to what is wrong with them.
+type fieldErrors map[string]string
+
+func respondWithFieldErrors(w http.ResponseWriter, errs fieldErrors) {
+	type errorResponse struct {
+		Error  string      `json:"error"`
+		Fields fieldErrors `json:"fields"`
+	}
+	respondWithJson(w, 422, errorResponse{Error: "Validation failed", Fields: errs})
+}
+
 func respondWithJson(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	data, err := json.Marshal(payload)
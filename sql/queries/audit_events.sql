@@ -0,0 +1,15 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events(id, created_at, event_type, actor_id, target, details)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+);
+
+-- name: GetAuditEvents :many
+SELECT * FROM audit_events
+ORDER BY created_at DESC
+LIMIT $1;
@@ -0,0 +1,54 @@
+-- name: CreateChirpEvent :one
+INSERT INTO chirp_events(created_at, type, chirp_id, user_id, body, chirp_created_at)
+VALUES (
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: NotifyChirpEvent :exec
+-- Wakes the event stream of every instance listening on chirp_events.
+SELECT pg_notify('chirp_events', sqlc.arg(payload)::text);
+
+-- name: GetChirpEventsAfter :many
+SELECT * FROM chirp_events
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: GetVisibleChirpEventsAfter :many
+-- For clients catching up. A chirp.created event is only visible while its
+-- chirp is, by the same rules as GetVisibleChirps; blocks are left to the
+-- stream's filter. Invisible events are still returned so the reader's
+-- cursor can move past them.
+SELECT chirp_events.*, (
+    chirp_events.type = 'chirp.deleted' OR EXISTS (
+        SELECT 1
+        FROM chirps
+        JOIN users ON users.id = chirps.user_id
+        WHERE chirps.id = chirp_events.chirp_id
+        AND (chirps.user_id = sqlc.arg(viewer_id)
+            OR (chirps.hidden_at IS NULL AND (users.shadow_banned_until IS NULL OR users.shadow_banned_until <= NOW())))
+    )
+)::BOOLEAN AS visible
+FROM chirp_events
+WHERE chirp_events.id > sqlc.arg(id)
+ORDER BY chirp_events.id ASC
+LIMIT sqlc.arg(max_results);
+
+-- name: DeleteChirpCreatedEvents :exec
+-- Removes a deleted or hidden chirp's body from the log, so it can't be
+-- replayed to clients catching up.
+DELETE FROM chirp_events
+WHERE chirp_id = $1 AND type = 'chirp.created';
+
+-- name: GetLatestChirpEventID :one
+SELECT COALESCE(MAX(id), 0)::BIGINT FROM chirp_events;
+
+-- name: DeleteChirpEventsBefore :execrows
+DELETE FROM chirp_events
+WHERE created_at < $1;
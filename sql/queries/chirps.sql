@@ -1,12 +1,12 @@
 -- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, flagged_at)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
-
+    $2,
+    $3
 )
 
     RETURNING *;
@@ -30,3 +30,54 @@ SELECT *
 FROM chirps
 WHERE user_id = $1;
 
+
+-- name: HideChirp :exec
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1;
+
+-- name: GetVisibleChirps :many
+-- Hidden chirps and chirps of shadow-banned users are only visible to their
+-- author, and chirps are never shown between users where either blocked the
+-- other. The timeline also leaves out users the viewer muted. viewer_id is
+-- uuid.Nil for anonymous readers.
+SELECT chirps.*
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE (chirps.user_id = sqlc.arg(viewer_id)
+    OR (chirps.hidden_at IS NULL AND (users.shadow_banned_until IS NULL OR users.shadow_banned_until <= NOW())))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+        OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(viewer_id) AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY chirps.created_at ASC;
+
+-- name: GetVisibleChirpsByUserID :many
+SELECT chirps.*
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.user_id = sqlc.arg(user_id) AND (chirps.user_id = sqlc.arg(viewer_id)
+    OR (chirps.hidden_at IS NULL AND (users.shadow_banned_until IS NULL OR users.shadow_banned_until <= NOW())))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+        OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+ORDER BY chirps.created_at ASC;
+
+-- name: GetVisibleChirpByID :one
+SELECT chirps.*
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = sqlc.arg(id) AND (chirps.user_id = sqlc.arg(viewer_id)
+    OR (chirps.hidden_at IS NULL AND (users.shadow_banned_until IS NULL OR users.shadow_banned_until <= NOW())))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+        OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+);
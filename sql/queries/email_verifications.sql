@@ -0,0 +1,19 @@
+-- name: CreateEmailVerification :one
+INSERT INTO email_verifications(id, created_at, user_id, email, expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    NOW() + INTERVAL '24 hours'
+)
+    RETURNING *;
+
+-- name: GetEmailVerification :one
+SELECT * FROM email_verifications
+WHERE id = $1;
+
+-- name: UseEmailVerification :execrows
+UPDATE email_verifications
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
@@ -0,0 +1,34 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules(id, created_at, updated_at, list, phrase, action, created_by)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetFilterRule :one
+SELECT * FROM filter_rules
+WHERE id = $1;
+
+-- name: GetFilterRules :many
+SELECT * FROM filter_rules
+ORDER BY list, phrase;
+
+-- name: UpdateFilterRule :one
+UPDATE filter_rules
+SET
+    list = $2,
+    phrase = $3,
+    action = $4,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules
+WHERE id = $1;
@@ -0,0 +1,22 @@
+-- name: CreateModerationAction :exec
+INSERT INTO moderation_actions(id, created_at, moderator_id, action, report_id, chirp_id, target_user_id, note)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
+
+-- name: GetModerationActions :many
+SELECT * FROM moderation_actions
+ORDER BY created_at DESC
+LIMIT $1;
+
+-- name: GetModerationActionsByReportID :many
+SELECT * FROM moderation_actions
+WHERE report_id = $1
+ORDER BY created_at ASC;
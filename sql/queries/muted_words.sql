@@ -0,0 +1,23 @@
+-- name: CreateMutedWord :one
+-- Muting the same phrase again replaces its expiry.
+INSERT INTO muted_words(id, created_at, user_id, kind, phrase, expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (user_id, kind, phrase) DO UPDATE SET expires_at = EXCLUDED.expires_at
+RETURNING *;
+
+-- name: GetActiveMutedWords :many
+SELECT * FROM muted_words
+WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY created_at DESC;
+
+-- name: DeleteMutedWord :execrows
+DELETE FROM muted_words
+WHERE id = $1 AND user_id = $2;
+
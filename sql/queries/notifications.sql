@@ -0,0 +1,80 @@
+-- name: CreateNotification :one
+-- Folds into the user's unread notification with the same group_key if
+-- there is one. Nothing is created, and no row returned, if the user turned
+-- the type off or blocked or muted the actor, or if a notification with the
+-- same non-empty event_id already exists.
+INSERT INTO notifications(id, created_at, updated_at, user_id, type, group_key, chirp_id, actor_ids, count, details, event_id)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    sqlc.arg(user_id),
+    sqlc.arg(type),
+    sqlc.arg(group_key),
+    sqlc.arg(chirp_id),
+    sqlc.arg(actor_ids)::UUID[],
+    1,
+    sqlc.arg(details),
+    sqlc.arg(event_id)
+WHERE NOT EXISTS (
+    SELECT 1 FROM notification_preferences
+    WHERE notification_preferences.user_id = sqlc.arg(user_id)
+        AND notification_preferences.type = sqlc.arg(type)
+        AND NOT notification_preferences.enabled
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(user_id) AND user_blocks.blocked_id = ANY(sqlc.arg(actor_ids)::UUID[]))
+        OR (user_blocks.blocked_id = sqlc.arg(user_id) AND user_blocks.blocker_id = ANY(sqlc.arg(actor_ids)::UUID[]))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(user_id) AND user_mutes.muted_id = ANY(sqlc.arg(actor_ids)::UUID[])
+)
+AND (sqlc.arg(event_id) = '' OR NOT EXISTS (
+    SELECT 1 FROM notifications
+    WHERE notifications.user_id = sqlc.arg(user_id) AND notifications.event_id = sqlc.arg(event_id)
+))
+ON CONFLICT (user_id, group_key) WHERE read_at IS NULL DO UPDATE SET
+    updated_at = NOW(),
+    count = notifications.count + CASE
+        WHEN cardinality(EXCLUDED.actor_ids) > 0 AND EXCLUDED.actor_ids <@ notifications.actor_ids THEN 0
+        ELSE 1
+    END,
+    actor_ids = (EXCLUDED.actor_ids || array_remove(notifications.actor_ids, EXCLUDED.actor_ids[1]))[1:10],
+    details = EXCLUDED.details
+RETURNING *;
+
+-- name: NotifyNotification :exec
+-- Wakes the realtime delivery of every instance listening on notifications.
+SELECT pg_notify('notifications', sqlc.arg(payload)::text);
+
+-- name: GetNotificationByID :one
+SELECT * FROM notifications
+WHERE id = $1;
+
+-- name: GetNotifications :many
+-- Newest first. Pass the created_at and id of the last notification of a
+-- page to get the next one. updated_at moves as events fold in, so paging
+-- on it could skip or repeat notifications.
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg(user_id)
+    AND (NOT sqlc.arg(unread_only)::BOOLEAN OR read_at IS NULL)
+    AND (sqlc.narg(before_created_at)::TIMESTAMP IS NULL
+        OR (created_at, id) < (sqlc.narg(before_created_at)::TIMESTAMP, sqlc.narg(before_id)::UUID))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationRead :execrows
+UPDATE notifications
+SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1 AND user_id = $2;
+
+-- name: MarkAllNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
@@ -0,0 +1,26 @@
+-- name: CreateOAuthRefreshToken :exec
+INSERT INTO oauth_refresh_tokens(token_hash, created_at, client_id, user_id, scopes, expires_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5
+);
+
+-- name: RevokeOAuthRefreshTokensForClient :exec
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE client_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOAuthRefreshTokensForUser :exec
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: UseOAuthRefreshToken :one
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE token_hash = $1 AND revoked_at IS NULL
+RETURNING *;
@@ -0,0 +1,23 @@
+-- name: CreatePasswordReset :exec
+INSERT INTO password_resets(id, created_at, user_id, token_hash, expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    NOW() + INTERVAL '1 hour'
+);
+
+-- name: GetPasswordResetByHash :one
+SELECT * FROM password_resets
+WHERE token_hash = $1;
+
+-- name: UsePasswordReset :execrows
+UPDATE password_resets
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: InvalidatePasswordResets :exec
+UPDATE password_resets
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
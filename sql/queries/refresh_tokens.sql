@@ -1,9 +1,9 @@
 -- name: GetRefreshTokenByToken :one
 SELECT * FROM refresh_tokens
-WHERE token = $1;
+WHERE token_hash = $1;
 
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens(token_hash, created_at, updated_at, user_id, expires_at, revoked_at, user_agent, ip_address)
 
 VALUES (
     $1,
@@ -11,11 +11,40 @@ VALUES (
     NOW(),
     $2,
     NOW() + INTERVAL '60 days',
-    NULL
+    NULL,
+    $3,
+    $4
 )
     RETURNING *;
 
 -- name: UpdateRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = $1, updated_at = $2
-WHERE token = $3;
+WHERE token_hash = $3;
+
+-- name: TouchRefreshToken :exec
+UPDATE refresh_tokens
+SET last_used_at = NOW(), ip_address = $2
+WHERE token_hash = $1;
+
+-- name: GetActiveRefreshTokensByUserID :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+ORDER BY created_at DESC;
+
+-- name: RevokeRefreshTokenByID :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: GetRefreshTokensByUserID :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
@@ -0,0 +1,56 @@
+-- name: CreateReport :one
+INSERT INTO reports(id, created_at, updated_at, chirp_id, reporter_id, reason, details)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetReportByID :one
+SELECT * FROM reports
+WHERE id = $1;
+
+-- name: GetReports :many
+SELECT reports.*, chirps.body AS chirp_body, chirps.user_id AS chirp_author_id, chirps.hidden_at AS chirp_hidden_at
+FROM reports
+LEFT JOIN chirps ON chirps.id = reports.chirp_id
+WHERE reports.status = $1
+ORDER BY reports.created_at ASC
+LIMIT $2;
+
+-- name: ClaimReport :one
+UPDATE reports
+SET
+    status = 'claimed',
+    claimed_by = $2,
+    claimed_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1 AND (status = 'open' OR (status = 'claimed' AND claimed_by = $2))
+RETURNING *;
+
+-- name: UnclaimReport :execrows
+UPDATE reports
+SET
+    status = 'open',
+    claimed_by = NULL,
+    claimed_at = NULL,
+    updated_at = NOW()
+WHERE id = $1 AND status = 'claimed' AND claimed_by = $2;
+
+-- name: ResolveReports :execrows
+-- Resolves the report and every other unresolved report of the same chirp,
+-- since one decision covers them all.
+UPDATE reports
+SET
+    status = 'resolved',
+    resolved_by = $3,
+    resolved_at = NOW(),
+    resolution = $4,
+    resolution_note = $5,
+    updated_at = NOW()
+WHERE (id = $1 OR chirp_id = $2) AND status <> 'resolved';
@@ -0,0 +1,21 @@
+-- name: CreateUserBlock :one
+-- Blocking someone twice keeps the original block.
+INSERT INTO user_blocks(blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (blocker_id, blocked_id) DO UPDATE SET created_at = user_blocks.created_at
+RETURNING *;
+
+-- name: GetUserBlocks :many
+SELECT * FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteUserBlock :execrows
+DELETE FROM user_blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: GetBlockedUserIDs :many
+-- Everyone the user blocked or was blocked by.
+SELECT blocked_id AS user_id FROM user_blocks WHERE user_blocks.blocker_id = $1
+UNION
+SELECT blocker_id AS user_id FROM user_blocks WHERE user_blocks.blocked_id = $1;
@@ -0,0 +1,25 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities(id, created_at, user_id, issuer, subject, email)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+    RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE issuer = $1 AND subject = $2;
+
+-- name: GetUserIdentitiesByUserID :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET last_login_at = NOW()
+WHERE id = $1;
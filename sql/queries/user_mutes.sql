@@ -0,0 +1,15 @@
+-- name: CreateUserMute :one
+-- Muting someone twice keeps the original mute.
+INSERT INTO user_mutes(muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (muter_id, muted_id) DO UPDATE SET created_at = user_mutes.created_at
+RETURNING *;
+
+-- name: GetUserMutes :many
+SELECT * FROM user_mutes
+WHERE muter_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteUserMute :execrows
+DELETE FROM user_mutes
+WHERE muter_id = $1 AND muted_id = $2;
@@ -36,3 +36,146 @@ SET
     is_chirpy_red = true,
     updated_at = NOW()
 WHERE id = $1;
+
+-- name: SetTOTPSecret :exec
+UPDATE users
+SET
+    totp_secret = $2,
+    totp_enabled = false,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: EnableTOTP :exec
+UPDATE users
+SET
+    totp_enabled = true,
+    totp_last_used_step = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: DisableTOTP :exec
+UPDATE users
+SET
+    totp_secret = NULL,
+    totp_enabled = false,
+    totp_last_used_step = 0,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_used_step = $2
+WHERE id = $1 AND totp_last_used_step < $2;
+
+-- name: MarkEmailVerified :exec
+UPDATE users
+SET
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateUserEmail :exec
+UPDATE users
+SET
+    email = $2,
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET
+    hashed_password = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateUserProfile :one
+-- Only applies if the row is unchanged since the caller read updated_at, so
+-- concurrent edits can't silently overwrite each other.
+UPDATE users
+SET
+    display_name = $2,
+    bio = $3,
+    updated_at = NOW()
+WHERE id = $1 AND updated_at = $4
+RETURNING *;
+
+-- name: UpdateUserRole :exec
+UPDATE users
+SET
+    role = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1;
+
+-- name: ScheduleUserDeletion :exec
+UPDATE users
+SET
+    deletion_scheduled_at = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: CancelUserDeletion :exec
+UPDATE users
+SET
+    deletion_scheduled_at = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteUsersScheduledBefore :many
+DELETE FROM users
+WHERE deletion_scheduled_at <= $1
+RETURNING id;
+
+-- name: SuspendUser :exec
+UPDATE users
+SET
+    suspended_until = $2,
+    suspension_reason = $3,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: LiftSuspension :execrows
+UPDATE users
+SET
+    suspended_until = NULL,
+    suspension_reason = '',
+    updated_at = NOW()
+WHERE id = $1 AND suspended_until IS NOT NULL;
+
+-- name: ShadowBanUser :exec
+UPDATE users
+SET
+    shadow_banned_until = $2,
+    shadow_ban_reason = $3,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: LiftShadowBan :execrows
+UPDATE users
+SET
+    shadow_banned_until = NULL,
+    shadow_ban_reason = '',
+    updated_at = NOW()
+WHERE id = $1 AND shadow_banned_until IS NOT NULL;
+
+-- name: LiftExpiredSuspensions :many
+UPDATE users
+SET
+    suspended_until = NULL,
+    suspension_reason = '',
+    updated_at = NOW()
+WHERE suspended_until <= NOW()
+RETURNING id;
+
+-- name: LiftExpiredShadowBans :many
+UPDATE users
+SET
+    shadow_banned_until = NULL,
+    shadow_ban_reason = '',
+    updated_at = NOW()
+WHERE shadow_banned_until <= NOW()
+RETURNING id;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Existing plaintext tokens are converted in place so current sessions survive.
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(token_hash::bytea), 'hex');
+
+-- +goose Down
+-- Hashes can't be turned back into tokens, so every session is invalidated.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
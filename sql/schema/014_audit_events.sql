@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    event_type TEXT NOT NULL,
+    actor_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    target TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX audit_events_created_at_idx ON audit_events(created_at);
+
+-- +goose Down
+DROP TABLE audit_events;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- NULL for public clients such as mobile and single page apps, which
+    -- can't keep a secret and rely on PKCE alone.
+    secret_hash TEXT NULL,
+    redirect_uris TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    revoked_at TIMESTAMP NULL
+);
+
+-- +goose Down
+DROP TABLE oauth_clients;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    -- The address the provider reported when the identity was linked.
+    email TEXT NOT NULL,
+    last_login_at TIMESTAMP NULL,
+    UNIQUE (issuer, subject)
+);
+
+-- +goose Down
+DROP TABLE user_identities;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Set when the user asks for their account to be deleted. The account is
+-- purged once this time has passed unless they log in again before then.
+ALTER TABLE users
+ADD COLUMN deletion_scheduled_at TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN deletion_scheduled_at;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Optional public profile fields. NULL means the user hasn't set one.
+ALTER TABLE users
+ADD COLUMN display_name TEXT NULL,
+ADD COLUMN bio TEXT NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN bio,
+DROP COLUMN display_name;
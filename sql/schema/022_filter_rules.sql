@@ -0,0 +1,20 @@
+-- +goose Up
+-- Words and phrases the chirp filter acts on, grouped into named lists.
+-- phrase is stored normalized (see filter.Normalize).
+CREATE TABLE filter_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    list TEXT NOT NULL DEFAULT 'default',
+    phrase TEXT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('mask', 'flag', 'reject')),
+    created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE (list, phrase)
+);
+
+-- The words that used to be hard-coded.
+INSERT INTO filter_rules (phrase, action)
+VALUES ('kerfuffle', 'mask'), ('sharbert', 'mask'), ('fornax', 'mask');
+
+-- +goose Down
+DROP TABLE filter_rules;
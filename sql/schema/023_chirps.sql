@@ -0,0 +1,8 @@
+-- +goose Up
+-- Set when the chirp filter flagged the chirp for moderator review.
+ALTER TABLE chirps
+ADD COLUMN flagged_at TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN flagged_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Set when a moderator hides the chirp. Hidden chirps are only shown to
+-- their author.
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
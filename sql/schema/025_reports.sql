@@ -0,0 +1,27 @@
+-- +goose Up
+-- Reports of chirps that may break the rules, worked through by moderators.
+-- reporter_id is NULL for chirps the chirp filter flagged.
+CREATE TABLE reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    chirp_id UUID NULL REFERENCES chirps(id) ON DELETE SET NULL,
+    reporter_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'claimed', 'resolved')),
+    claimed_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    claimed_at TIMESTAMP NULL,
+    resolved_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP NULL,
+    resolution TEXT NOT NULL DEFAULT '',
+    resolution_note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX reports_status_created_at_idx ON reports(status, created_at);
+-- One open report per chirp and reporter.
+CREATE UNIQUE INDEX reports_open_reporter_idx ON reports(chirp_id, reporter_id)
+WHERE status <> 'resolved';
+
+-- +goose Down
+DROP TABLE reports;
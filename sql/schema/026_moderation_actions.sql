@@ -0,0 +1,17 @@
+-- +goose Up
+-- Every action a moderator takes, so moderation decisions can be reviewed.
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    moderator_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    report_id UUID NULL REFERENCES reports(id) ON DELETE SET NULL,
+    chirp_id UUID NULL,
+    target_user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX moderation_actions_created_at_idx ON moderation_actions(created_at);
+
+-- +goose Down
+DROP TABLE moderation_actions;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- A suspended user can't log in or refresh a session until suspended_until
+-- has passed.
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP NULL,
+ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN suspension_reason,
+DROP COLUMN suspended_until;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- A shadow-banned user's chirps are only shown to themselves until
+-- shadow_banned_until has passed.
+ALTER TABLE users
+ADD COLUMN shadow_banned_until TIMESTAMP NULL,
+ADD COLUMN shadow_ban_reason TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN shadow_ban_reason,
+DROP COLUMN shadow_banned_until;
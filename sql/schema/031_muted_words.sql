@@ -0,0 +1,15 @@
+-- +goose Up
+-- Words, phrases and hashtags a user doesn't want to see chirps about.
+-- phrase is stored normalized, hashtags without their '#'.
+CREATE TABLE muted_words (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('word', 'hashtag')),
+    phrase TEXT NOT NULL,
+    expires_at TIMESTAMP NULL,
+    UNIQUE (user_id, kind, phrase)
+);
+
+-- +goose Down
+DROP TABLE muted_words;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- A short log of chirps being posted and removed, for the event stream. id
+-- is the SSE event ID clients resume from. chirp_id has no foreign key so
+-- events outlive deleted chirps.
+CREATE TABLE chirp_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    type TEXT NOT NULL CHECK (type IN ('chirp.created', 'chirp.deleted')),
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    chirp_created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX chirp_events_created_at_idx ON chirp_events(created_at);
+
+-- +goose Down
+DROP TABLE chirp_events;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- In-app notifications. Similar notifications share a group_key and are
+-- folded into one unread row, counting the events and keeping the most
+-- recent actors first.
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('follow', 'like', 'reply', 'mention', 'rechirp', 'subscription')),
+    group_key TEXT NOT NULL,
+    chirp_id UUID NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    actor_ids UUID[] NOT NULL DEFAULT '{}',
+    count INTEGER NOT NULL DEFAULT 1,
+    details TEXT NOT NULL DEFAULT '',
+    read_at TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications(user_id, group_key) WHERE read_at IS NULL;
+CREATE INDEX notifications_user_id_updated_at_idx ON notifications(user_id, updated_at DESC, id DESC);
+
+-- +goose Down
+DROP TABLE notifications;
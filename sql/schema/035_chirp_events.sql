@@ -0,0 +1,10 @@
+-- +goose Up
+-- Events go with their author, so purging an account leaves none of their
+-- chirps behind for the event stream to replay.
+DELETE FROM chirp_events WHERE user_id NOT IN (SELECT id FROM users);
+ALTER TABLE chirp_events
+ADD CONSTRAINT chirp_events_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE chirp_events
+DROP CONSTRAINT chirp_events_user_id_fkey;
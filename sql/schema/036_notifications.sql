@@ -0,0 +1,9 @@
+-- +goose Up
+-- Notifications are paged on created_at, which unlike updated_at doesn't
+-- move when more events fold in.
+DROP INDEX notifications_user_id_updated_at_idx;
+CREATE INDEX notifications_user_id_created_at_idx ON notifications(user_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX notifications_user_id_created_at_idx;
+CREATE INDEX notifications_user_id_updated_at_idx ON notifications(user_id, updated_at DESC, id DESC);
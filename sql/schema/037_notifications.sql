@@ -0,0 +1,9 @@
+-- +goose Up
+-- Notifications raised by a webhook remember the delivery's event id, so a
+-- retried delivery doesn't notify the user twice.
+ALTER TABLE notifications ADD COLUMN event_id TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX notifications_user_id_event_id_idx ON notifications(user_id, event_id) WHERE event_id <> '';
+
+-- +goose Down
+DROP INDEX notifications_user_id_event_id_idx;
+ALTER TABLE notifications DROP COLUMN event_id;
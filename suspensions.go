@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hconn7/Chirpy/internal/auth"
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+// maxRestriction caps how long a moderator can suspend or shadow-ban
+// someone for.
+const maxRestriction = 365 * 24 * time.Hour
+
+// parseRestrictionDuration parses how long a suspension or shadow ban lasts.
+func parseRestrictionDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 || d > maxRestriction {
+		return 0, errors.New("must be a duration like 72h, at most a year")
+	}
+	return d, nil
+}
+
+// isSuspended reports whether the user is currently barred from logging in.
+// A suspension lifts on its own once suspended_until has passed.
+func isSuspended(user database.User, now time.Time) bool {
+	return user.SuspendedUntil.Valid && now.Before(user.SuspendedUntil.Time)
+}
+
+// isShadowBanned reports whether the user's chirps are currently hidden from
+// everyone else.
+func isShadowBanned(user database.User, now time.Time) bool {
+	return user.ShadowBannedUntil.Valid && now.Before(user.ShadowBannedUntil.Time)
+}
+
+// checkNotSuspended writes a 403 and returns false for a suspended user.
+func checkNotSuspended(w http.ResponseWriter, user database.User) bool {
+	if !isSuspended(user, time.Now()) {
+		return true
+	}
+	msg := "Account suspended until " + user.SuspendedUntil.Time.UTC().Format(time.RFC3339)
+	if user.SuspensionReason != "" {
+		msg += ": " + user.SuspensionReason
+	}
+	respondWithError(w, 403, msg, nil)
+	return false
+}
+
+// suspendUser bars a user from logging in until the given time and signs
+// them out of every session, token and app.
+func (cfg *apiConfig) suspendUser(ctx context.Context, user database.User, until time.Time, reason string) error {
+	if err := cfg.dbQueries.SuspendUser(ctx, database.SuspendUserParams{
+		ID:               user.ID,
+		SuspendedUntil:   sql.NullTime{Time: until, Valid: true},
+		SuspensionReason: reason,
+	}); err != nil {
+		return err
+	}
+	return revokeAllCredentials(ctx, cfg.dbQueries, user.ID)
+}
+
+// liftExpiredRestrictions clears suspensions and shadow bans whose time is
+// up. They already stopped applying when they expired; this records it.
+func (cfg *apiConfig) liftExpiredRestrictions(ctx context.Context) {
+	suspensions, err := cfg.dbQueries.LiftExpiredSuspensions(ctx)
+	if err != nil {
+		log.Printf("Couldn't lift expired suspensions: %v", err)
+	}
+	for _, id := range suspensions {
+		cfg.recordModerationAction(ctx, database.CreateModerationActionParams{
+			Action:       "suspension_expired",
+			TargetUserID: uuid.NullUUID{UUID: id, Valid: true},
+		})
+	}
+
+	shadowBans, err := cfg.dbQueries.LiftExpiredShadowBans(ctx)
+	if err != nil {
+		log.Printf("Couldn't lift expired shadow bans: %v", err)
+	}
+	for _, id := range shadowBans {
+		cfg.recordModerationAction(ctx, database.CreateModerationActionParams{
+			Action:       "shadow_ban_expired",
+			TargetUserID: uuid.NullUUID{UUID: id, Valid: true},
+		})
+	}
+}
+
+func (cfg *apiConfig) runRestrictionLifter(interval time.Duration) {
+	for {
+		cfg.liftExpiredRestrictions(context.Background())
+		time.Sleep(interval)
+	}
+}
+
+type UserRestrictions struct {
+	UserID            uuid.UUID  `json:"user_id"`
+	SuspendedUntil    *time.Time `json:"suspended_until"`
+	SuspensionReason  string     `json:"suspension_reason,omitempty"`
+	ShadowBannedUntil *time.Time `json:"shadow_banned_until"`
+	ShadowBanReason   string     `json:"shadow_ban_reason,omitempty"`
+}
+
+func toUserRestrictions(user database.User) UserRestrictions {
+	now := time.Now()
+	resp := UserRestrictions{UserID: user.ID}
+	if isSuspended(user, now) {
+		resp.SuspendedUntil = &user.SuspendedUntil.Time
+		resp.SuspensionReason = user.SuspensionReason
+	}
+	if isShadowBanned(user, now) {
+		resp.ShadowBannedUntil = &user.ShadowBannedUntil.Time
+		resp.ShadowBanReason = user.ShadowBanReason
+	}
+	return resp
+}
+
+// moderatedUser loads the user named in the path for a moderator to act on.
+// Moderators can only restrict regular users. It writes the error response
+// and returns false on failure.
+func (cfg *apiConfig) moderatedUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid user ID", err)
+		return database.User{}, false
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return database.User{}, false
+	}
+	if user.Role != string(auth.RoleUser) {
+		respondWithError(w, 403, "Moderators and admins can't be restricted", nil)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+type restrictionParams struct {
+	Duration string `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+// decodeRestriction reads how long and why a user is being restricted. It
+// writes the error response and returns false on failure.
+func decodeRestriction(w http.ResponseWriter, r *http.Request) (time.Time, string, bool) {
+	var params restrictionParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, 400, "Couldn't decode params", err)
+		return time.Time{}, "", false
+	}
+	d, err := parseRestrictionDuration(params.Duration)
+	if err != nil {
+		respondWithError(w, 400, "duration "+err.Error(), nil)
+		return time.Time{}, "", false
+	}
+	reason := strings.TrimSpace(params.Reason)
+	if reason == "" {
+		respondWithError(w, 400, "A reason is required", nil)
+		return time.Time{}, "", false
+	}
+	return time.Now().Add(d), reason, true
+}
+
+func (cfg *apiConfig) handlerGetUserRestrictions(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid user ID", err)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 404, "User not found", err)
+		return
+	}
+	respondWithJson(w, 200, toUserRestrictions(user))
+}
+
+// handlerSuspendUser suspends a user for a period. They are signed out
+// everywhere and can't log in until it ends. A new suspension replaces the
+// current one.
+func (cfg *apiConfig) handlerSuspendUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.moderatedUser(w, r)
+	if !ok {
+		return
+	}
+	until, reason, ok := decodeRestriction(w, r)
+	if !ok {
+		return
+	}
+	moderator, _ := actorFromContext(r.Context())
+
+	if err := cfg.suspendUser(r.Context(), user, until, reason); err != nil {
+		respondWithError(w, 500, "Couldn't suspend user", err)
+		return
+	}
+	cfg.recordModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		Action:       "suspend",
+		TargetUserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Note:         reason,
+	})
+	cfg.notifyAuthor(r.Context(), user, "Your Chirpy account has been suspended",
+		fmt.Sprintf("A moderator suspended your account until %s:\n\n%s", until.UTC().Format(time.RFC1123), reason))
+
+	user.SuspendedUntil = sql.NullTime{Time: until, Valid: true}
+	user.SuspensionReason = reason
+	respondWithJson(w, 200, toUserRestrictions(user))
+}
+
+func (cfg *apiConfig) handlerLiftSuspension(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.moderatedUser(w, r)
+	if !ok {
+		return
+	}
+	moderator, _ := actorFromContext(r.Context())
+
+	lifted, err := cfg.dbQueries.LiftSuspension(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't lift suspension", err)
+		return
+	}
+	if lifted == 0 {
+		respondWithError(w, 409, "User isn't suspended", nil)
+		return
+	}
+	cfg.recordModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		Action:       "unsuspend",
+		TargetUserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+	})
+	w.WriteHeader(204)
+}
+
+// handlerShadowBanUser hides a user's chirps from everyone but themselves
+// for a period. Unlike a suspension the user isn't told.
+func (cfg *apiConfig) handlerShadowBanUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.moderatedUser(w, r)
+	if !ok {
+		return
+	}
+	until, reason, ok := decodeRestriction(w, r)
+	if !ok {
+		return
+	}
+	moderator, _ := actorFromContext(r.Context())
+
+	if err := cfg.dbQueries.ShadowBanUser(r.Context(), database.ShadowBanUserParams{
+		ID:                user.ID,
+		ShadowBannedUntil: sql.NullTime{Time: until, Valid: true},
+		ShadowBanReason:   reason,
+	}); err != nil {
+		respondWithError(w, 500, "Couldn't shadow-ban user", err)
+		return
+	}
+	cfg.recordModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		Action:       "shadow_ban",
+		TargetUserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Note:         reason,
+	})
+
+	user.ShadowBannedUntil = sql.NullTime{Time: until, Valid: true}
+	user.ShadowBanReason = reason
+	respondWithJson(w, 200, toUserRestrictions(user))
+}
+
+func (cfg *apiConfig) handlerLiftShadowBan(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.moderatedUser(w, r)
+	if !ok {
+		return
+	}
+	moderator, _ := actorFromContext(r.Context())
+
+	lifted, err := cfg.dbQueries.LiftShadowBan(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, "Couldn't lift shadow ban", err)
+		return
+	}
+	if lifted == 0 {
+		respondWithError(w, 409, "User isn't shadow-banned", nil)
+		return
+	}
+	cfg.recordModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		Action:       "unshadow_ban",
+		TargetUserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+	})
+	w.WriteHeader(204)
+}
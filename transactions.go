@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+
+	"github.com/hconn7/Chirpy/internal/database"
+)
+
+// inTx runs fn with queries bound to a single transaction, which is
+// committed if fn returns nil and rolled back otherwise.
+func (cfg *apiConfig) inTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(cfg.dbQueries.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}